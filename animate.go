@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// minEditInterval keeps the edits of an animated reply under the rate limit of discord.
+	minEditInterval = 1500 * time.Millisecond
+	// maxAnimation is how long the replay lasts at most, the rest of the output is shown at once.
+	maxAnimation = 30 * time.Second
+)
+
+// animate replies with the output the way the program printed it: the reply is edited as the recorded delays pass.
+func animate(s *discordgo.Session, m *discordgo.Message, events []Event, link string) {
+	var (
+		at    = make([]time.Duration, len(events))
+		total time.Duration
+		shown int
+	)
+
+	for i, e := range events {
+		total += e.Delay
+		at[i] = total
+	}
+
+	for shown < len(events) && at[shown] <= 0 {
+		shown++
+	}
+
+	msg := sendDeletable(s, m, animationFrame(events[:shown], link), 5*time.Minute)
+	if msg == nil {
+		return
+	}
+
+	go func() {
+		start := time.Now()
+
+		for shown < len(events) {
+			next := at[shown]
+			if next > maxAnimation {
+				next = maxAnimation
+			}
+
+			wait := next - time.Since(start)
+			if wait < minEditInterval {
+				wait = minEditInterval
+			}
+
+			time.Sleep(wait)
+
+			elapsed := time.Since(start)
+			for shown < len(events) && (at[shown] <= elapsed || elapsed >= maxAnimation) {
+				shown++
+			}
+
+			_, err := s.ChannelMessageEdit(msg.ChannelID, msg.ID, animationFrame(events[:shown], link))
+			if err != nil {
+				// most likely the reply is deleted
+				log.Println("animate:", err)
+
+				return
+			}
+		}
+	}()
+}
+
+// animationFrame renders the output printed so far like a terminal would: a carriage return rewrites the line.
+// The tail of the output is kept when it doesn't fit into the message.
+func animationFrame(events []Event, link string) string {
+	var b strings.Builder
+	for _, e := range events {
+		b.WriteString(e.Message)
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		if cr := strings.LastIndexByte(strings.TrimSuffix(line, "\r"), '\r'); cr != -1 {
+			lines[i] = line[cr+1:]
+		}
+	}
+
+	output := strings.Join(lines, "\n")
+	if output == "" {
+		output = "..."
+	}
+
+	const animationTemplate = "*Result*:\n```\n\n```"
+
+	if max := 2000 - len(animationTemplate) - len(link) - len("\n"); len(output) > max {
+		output = output[len(output)-max:]
+		for len(output) > 0 && !utf8.RuneStart(output[0]) {
+			output = output[1:]
+		}
+	}
+
+	frame := "*Result*:\n```\n" + output + "\n```"
+	if link != "" {
+		frame = link + "\n" + frame
+	}
+
+	return frame
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/txtar"
+)
+
+// Discord colours the ```ansi code blocks, only the basic SGR codes are understood.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiBlue   = "\x1b[34m"
+	ansiGray   = "\x1b[30m"
+)
+
+type diagnostic struct {
+	file      string // empty if the line isn't a positioned message
+	line, col int
+	message   string
+}
+
+var diagnosticRe = regexp.MustCompile(`^\s*(?:\./)?([^\s:]+\.go):(\d+)(?::(\d+))?:\s*(.*)$`)
+
+// parseDiagnostics splits the compiler and vet output into messages, the positioned ones get their file, line and column.
+func parseDiagnostics(errs string) []diagnostic {
+	var diags []diagnostic
+
+	for _, line := range strings.Split(strings.TrimRight(errs, "\n"), "\n") {
+		match := diagnosticRe.FindStringSubmatch(line)
+		if match == nil {
+			diags = append(diags, diagnostic{message: line})
+
+			continue
+		}
+
+		d := diagnostic{file: match[1], message: match[4]}
+		d.line, _ = strconv.Atoi(match[2])
+		d.col, _ = strconv.Atoi(match[3])
+
+		diags = append(diags, d)
+	}
+
+	return diags
+}
+
+// sourceLine finds the line of the file in the source the positions refer to.
+// The main file is the text before the first file marker, the executors call it prog.go or prog_test.go.
+func sourceLine(source, file string, line int) (string, bool) {
+	arch := txtar.Parse([]byte(source))
+
+	var data []byte
+	for _, f := range arch.Files {
+		if path.Clean(f.Name) == file {
+			data = f.Data
+		}
+	}
+
+	if data == nil && (file == "prog.go" || file == "prog_test.go") {
+		data = arch.Comment
+	}
+
+	lines := strings.Split(string(data), "\n")
+	if data == nil || line < 1 || line > len(lines) {
+		return "", false
+	}
+
+	return lines[line-1], true
+}
+
+// caretLine points at the column of the source line, the tabs before it are kept so the caret lines up.
+func caretLine(src string, col int) string {
+	var b strings.Builder
+
+	for i := 0; i < col-1 && i < len(src); i++ {
+		if src[i] == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+
+	return b.String() + "^"
+}
+
+func ansiDiagnostics(b *strings.Builder, errs, source string) {
+	for _, d := range parseDiagnostics(errs) {
+		if d.file == "" {
+			b.WriteString(ansiGray + d.message + ansiReset + "\n")
+
+			continue
+		}
+
+		pos := fmt.Sprintf("%s:%d", d.file, d.line)
+		if d.col > 0 {
+			pos += fmt.Sprintf(":%d", d.col)
+		}
+
+		b.WriteString(ansiBold + ansiBlue + pos + ":" + ansiReset + " " + ansiRed + d.message + ansiReset + "\n")
+
+		src, ok := sourceLine(source, d.file, d.line)
+		if !ok || strings.TrimSpace(src) == "" {
+			continue
+		}
+
+		gutter := fmt.Sprintf("%5d | ", d.line)
+		b.WriteString(ansiGray + gutter + ansiReset + src + "\n")
+
+		if d.col > 0 {
+			b.WriteString(ansiGray + strings.Repeat(" ", len(gutter)-2) + "| " + ansiReset + ansiBold + ansiYellow + caretLine(src, d.col) + ansiReset + "\n")
+		}
+	}
+}
+
+// renderANSI renders the errors with the offending lines and the output with stderr in red into an ansi code block.
+func renderANSI(response *playgroundResponse, source string, vet bool, link string) interface{} {
+	var b strings.Builder
+
+	if vet {
+		b.WriteString(ansiBold + "vet" + ansiReset + "\n")
+
+		if response.VetErrors != "" {
+			ansiDiagnostics(&b, response.VetErrors, source)
+		} else {
+			b.WriteString(vetReport(response))
+		}
+
+		b.WriteString("\n")
+	}
+
+	if response.Errors != "" {
+		ansiDiagnostics(&b, response.Errors, source)
+	}
+
+	for _, e := range coalesceEvents(response.Events, 0) {
+		if !isPrintable(e.Message) {
+			continue
+		}
+
+		if e.Kind == "stderr" {
+			b.WriteString(ansiRed + strings.TrimSuffix(e.Message, "\n") + ansiReset + "\n")
+		} else {
+			b.WriteString(e.Message)
+		}
+	}
+
+	if response.Errors == "" && len(response.Events) == 0 {
+		b.WriteString("There's nothing to print out.\n")
+	}
+
+	const ansiTemplate = "```ansi\n\n```"
+
+	// the text is cut on a line boundary, so no colour code is cut in half
+	result := b.String()
+	cut := false
+
+	if max := 2000 - len(ansiTemplate) - len(ansiReset) - len(link) - len("\n"); len(result) > max {
+		result = result[:strings.LastIndexByte(result[:max], '\n')+1] + ansiReset
+		cut = true
+	}
+
+	reply := "```ansi\n" + strings.TrimSuffix(result, "\n") + "\n```"
+
+	return withFiles(reply, outputFiles(response, cut, cut))
+}
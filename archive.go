@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"strings"
+
+	"golang.org/x/tools/txtar"
+)
+
+// Multi-file snippets are sent as txtar archives, the playground takes the text before the first
+// -- name -- marker as prog.go and the sections after it as the rest of the module.
+
+type codeBlock struct {
+	lang string
+	code string
+}
+
+// findCodeBlocks returns every ``` block of the message along with its language tag.
+func findCodeBlocks(str string) []codeBlock {
+	var blocks []codeBlock
+
+	for {
+		start := strings.Index(str, "```")
+		if start == -1 {
+			return blocks
+		}
+
+		str = str[start+len("```"):]
+
+		end := strings.Index(str, "```")
+		if end == -1 {
+			return blocks
+		}
+
+		block := codeBlock{code: str[:end]}
+		str = str[end+len("```"):]
+
+		if nl := strings.IndexByte(block.code, '\n'); nl != -1 {
+			tag := strings.TrimSpace(block.code[:nl])
+			if !strings.ContainsAny(tag, " \t(){}[]=:;.,\"'") {
+				block.lang = tag
+				block.code = block.code[nl+1:]
+			}
+		}
+
+		blocks = append(blocks, block)
+	}
+}
+
+// findSources is findCodeBlock which also joins several code blocks into one archive.
+// The blocks may name themselves with a -- name -- first line, go.mod is recognized by its module line.
+// Out of several blocks only the go, golang and txtar ones, the named ones and go.mod are taken,
+// the rest is rather the output or the commands which go along with the code.
+func findSources(str string) string {
+	blocks := findCodeBlocks(str)
+	if len(blocks) == 1 && blocks[0].lang == "txtar" {
+		// findCodeBlock knows the go tags only
+		return "\n" + blocks[0].code
+	}
+
+	if len(blocks) < 2 {
+		return findCodeBlock(str)
+	}
+
+	var sources []codeBlock
+
+	for _, blk := range blocks {
+		code := strings.TrimLeft(blk.code, "\n")
+
+		switch {
+		case strings.HasPrefix(code, "-- "), isModBlock(blk):
+		case blk.lang == "go" || blk.lang == "golang" || blk.lang == "txtar":
+		default:
+			continue
+		}
+
+		sources = append(sources, codeBlock{lang: blk.lang, code: code})
+	}
+
+	// without any source block the first one is the code
+	if len(sources) == 0 {
+		sources = blocks[:1]
+	}
+
+	if len(sources) == 1 && !strings.HasPrefix(sources[0].code, "-- ") && !isModBlock(sources[0]) {
+		// the code block starts on the line after the tag
+		return "\n" + strings.TrimLeft(sources[0].code, "\n")
+	}
+
+	var b strings.Builder
+
+	n := 0
+	for _, blk := range sources {
+		switch {
+		case strings.HasPrefix(blk.code, "-- "):
+		case isModBlock(blk):
+			b.WriteString("-- go.mod --\n")
+		default:
+			n++
+			if n == 1 {
+				b.WriteString("-- prog.go --\n")
+			} else {
+				fmt.Fprintf(&b, "-- prog%d.go --\n", n)
+			}
+		}
+
+		b.WriteString(blk.code)
+		if !strings.HasSuffix(blk.code, "\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+func isModBlock(blk codeBlock) bool {
+	return blk.lang == "mod" || (blk.lang == "" || blk.lang == "go") && strings.HasPrefix(strings.TrimSpace(blk.code), "module ")
+}
+
+// splitArchive separates the main file from the rest of the archive.
+// The main file is the text before the first marker, prog.go, main.go or the first go file at the root, in that order.
+func splitArchive(code string) (string, []txtar.File) {
+	arch := txtar.Parse(s2b(code))
+	if len(arch.Files) == 0 {
+		return code, nil
+	}
+
+	if strings.TrimSpace(string(arch.Comment)) != "" {
+		return string(arch.Comment), arch.Files
+	}
+
+	main := -1
+	for _, name := range []string{"prog.go", "main.go"} {
+		for i, f := range arch.Files {
+			if main == -1 && path.Clean(f.Name) == name {
+				main = i
+			}
+		}
+	}
+
+	for i, f := range arch.Files {
+		if main == -1 && strings.HasSuffix(f.Name, ".go") && !strings.Contains(path.Clean(f.Name), "/") {
+			main = i
+		}
+	}
+
+	if main == -1 {
+		return "", arch.Files
+	}
+
+	files := append(arch.Files[:main:main], arch.Files[main+1:]...)
+
+	return string(arch.Files[main].Data), files
+}
+
+// joinArchive puts the prepared main file back in front of the rest of the files.
+func joinArchive(main []byte, files []txtar.File) []byte {
+	if len(files) == 0 {
+		return main
+	}
+
+	if len(main) > 0 && main[len(main)-1] != '\n' {
+		main = append(main, '\n')
+	}
+
+	return append(main, txtar.Format(&txtar.Archive{Files: files})...)
+}
+
+// prepareArchiveFiles does to the files besides the main one what CompileAndRun does to it:
+// stubs the package clause, named after the directory, and adds the std imports the file is missing.
+func prepareArchiveFiles(files []txtar.File, std []string) []txtar.File {
+	prepared := make([]txtar.File, 0, len(files))
+
+	for _, file := range files {
+		if strings.HasSuffix(file.Name, ".go") {
+			file.Data = prepareArchiveFile(file.Name, file.Data, std)
+		}
+
+		prepared = append(prepared, file)
+	}
+
+	return prepared
+}
+
+func prepareArchiveFile(name string, data []byte, std []string) []byte {
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, name, data, 0)
+	if err != nil && strings.Contains(err.Error(), "expected 'package'") {
+		pkg := "main"
+		if dir := path.Dir(path.Clean(name)); dir != "." {
+			pkg = path.Base(dir)
+		}
+
+		data = append([]byte("package "+pkg+"\n"), data...)
+		f, err = parser.ParseFile(fset, name, data, 0)
+	}
+
+	if err != nil {
+		// the compiler is going to tell about it better
+		return data
+	}
+
+	addMissingImports(fset, f, std)
+
+	var buf bytes.Buffer
+
+	err = format.Node(&buf, fset, f)
+	if err != nil {
+		return data
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var attachmentClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// maxAttachmentSize caps every attachment taken as code.
+const maxAttachmentSize = maxSnippetSize
+
+// withAttachments adds the .go, .txt and .txtar attachments of the message to its code blocks,
+// so findSources makes one archive out of all of them. The content is returned as it is if there's nothing attached.
+func withAttachments(content string, m *discordgo.Message) (string, error) {
+	var b strings.Builder
+
+	for _, a := range m.Attachments {
+		ext := path.Ext(strings.ToLower(a.Filename))
+		if ext != ".go" && ext != ".txt" && ext != ".txtar" {
+			continue
+		}
+
+		if a.Size > maxAttachmentSize {
+			return "", fmt.Errorf("%s is too big, %d KiB at most please.", a.Filename, maxAttachmentSize>>10)
+		}
+
+		data, err := downloadAttachment(a.URL)
+		if err != nil {
+			return "", err
+		}
+
+		// the tags keep the blocks among the sources of findSources, a .txt is go code
+		switch ext {
+		case ".go":
+			fmt.Fprintf(&b, "```go\n-- %s --\n", path.Base(a.Filename))
+		case ".txt":
+			b.WriteString("```go\n")
+		case ".txtar":
+			b.WriteString("```txtar\n")
+		}
+
+		b.WriteString(data)
+		b.WriteString("\n```\n")
+	}
+
+	if b.Len() == 0 {
+		return content, nil
+	}
+
+	// the text around the attached files isn't code unless it's in a code block
+	for _, blk := range findCodeBlocks(content) {
+		b.WriteString("```" + blk.lang + "\n" + blk.code + "\n```\n")
+	}
+
+	return b.String(), nil
+}
+
+func downloadAttachment(url string) (string, error) {
+	resp, err := attachmentClient.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("downloadAttachment: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("downloadAttachment: got non-200 response: %s", resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxAttachmentSize))
+	if err != nil {
+		return "", fmt.Errorf("downloadAttachment: %v", err)
+	}
+
+	return string(data), nil
+}
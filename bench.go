@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// benchmarks returns the names of the func BenchmarkXxx(*testing.B) matching the pattern, in the declaration order.
+func benchmarks(f *ast.File, pattern string) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Bad -bench pattern: %v", err)
+	}
+
+	var names []string
+	for _, d := range f.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Benchmark") {
+			continue
+		}
+
+		if isTestingParam(fn.Type, "B") && re.MatchString(fn.Name.Name) {
+			names = append(names, fn.Name.Name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("There's no func BenchmarkXxx(b *testing.B) matching %q.", pattern)
+	}
+
+	return names, nil
+}
+
+// benchRunner replaces main with the one which runs the benchmarks one by one and prints their results after benchMarker.
+func benchRunner(names []string) string {
+	var list strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&list, "\t\t{%q, %s},\n", name, name)
+	}
+
+	return fmt.Sprintf(benchTemplate, list.String(), strconv.Quote(benchMarker+"%s\t%d\t%d\t%d\t%d\n"))
+}
+
+const benchMarker = "⁣bench\t"
+
+var benchTemplate = `
+func main() {
+	for _, 基准 := range []struct {
+		name string
+		f    func(*testing.B)
+	}{
+%s	} {
+		結果 := testing.Benchmark(基准.f)
+		fmt.Printf(%s, 基准.name, 結果.N, 結果.T.Nanoseconds(), 結果.AllocedBytesPerOp(), 結果.AllocsPerOp())
+	}
+}
+`
+
+type benchResult struct {
+	name     string
+	n        int64
+	nsPerOp  float64
+	bytesOp  int64
+	allocsOp int64
+}
+
+// parseBenchOutput picks the benchmark results out of the program output, the rest is returned as it is.
+func parseBenchOutput(events []Event) ([]benchResult, []Event) {
+	var (
+		results []benchResult
+		rest    []Event
+	)
+
+	for _, e := range events {
+		if e.Kind != "stdout" || !strings.Contains(e.Message, benchMarker) {
+			rest = append(rest, e)
+
+			continue
+		}
+
+		var other strings.Builder
+		for _, line := range strings.SplitAfter(e.Message, "\n") {
+			i := strings.Index(line, benchMarker)
+			if i == -1 {
+				other.WriteString(line)
+
+				continue
+			}
+
+			other.WriteString(line[:i])
+
+			fields := strings.Split(strings.TrimSpace(line[i+len(benchMarker):]), "\t")
+			if len(fields) != 5 {
+				continue
+			}
+
+			var nums [4]int64
+			for j := range nums {
+				nums[j], _ = strconv.ParseInt(fields[j+1], 10, 64)
+			}
+
+			r := benchResult{
+				name:     fields[0],
+				n:        nums[0],
+				bytesOp:  nums[2],
+				allocsOp: nums[3],
+			}
+
+			if r.n > 0 {
+				r.nsPerOp = float64(nums[1]) / float64(r.n)
+			}
+
+			results = append(results, r)
+		}
+
+		if other.Len() > 0 {
+			e.Message = other.String()
+			rest = append(rest, e)
+		}
+	}
+
+	return results, rest
+}
+
+func benchTable(results []benchResult) string {
+	var buf bytes.Buffer
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "benchmark\tN\tns/op\tB/op\tallocs/op\t")
+
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%d\t%d\t\n", strings.TrimPrefix(r.name, "Benchmark"), r.n, r.nsPerOp, r.bytesOp, r.allocsOp)
+	}
+
+	w.Flush()
+
+	return buf.String()
+}
+
+// renderBenchmarks renders the table of the results along with the rest of the output,
+// the whole text is attached if any of it doesn't fit.
+func renderBenchmarks(response *playgroundResponse, plain bool, footer string) interface{} {
+	results, rest := parseBenchOutput(response.Events)
+
+	table := "No results, did the benchmarks finish in time?\n"
+	if len(results) > 0 {
+		table = benchTable(results)
+	}
+
+	var output strings.Builder
+	for _, e := range rest {
+		output.WriteString(e.Message)
+	}
+
+	whole := table
+	if output.Len() > 0 {
+		whole += "\n" + output.String()
+	}
+
+	if len(response.Errors) > 0 {
+		whole = response.Errors + "\n" + whole
+	}
+
+	if plain {
+		result := whole
+
+		const plainBenchTemplate = "*Benchmarks*:\n```\n%s\n```"
+
+		cut := len(result) > 2000-len(plainBenchTemplate)
+		if cut {
+			result = result[:2000-len(plainBenchTemplate)]
+		}
+
+		return withFiles(fmt.Sprintf(plainBenchTemplate, result), benchFiles(whole, cut))
+	}
+
+	cut := len(table) > 4096-len("```\n```")-len("\nThe whole thing is attached.")
+	if cut {
+		table = table[:4096-len("```\n```")-len("\nThe whole thing is attached.")]
+	}
+
+	emb := &discordgo.MessageEmbed{
+		Title:       "Benchmarks:",
+		Description: "```\n" + table + "```",
+	}
+
+	for _, field := range []struct{ name, value string }{{"errors", response.Errors}, {"output", output.String()}} {
+		if !isPrintable(field.value) {
+			continue
+		}
+
+		if len(field.value) > 1024-len("```\n```") {
+			field.value = field.value[:1024-len("```\n```")]
+			cut = true
+		}
+
+		emb.Fields = append(emb.Fields, &discordgo.MessageEmbedField{
+			Name:  field.name,
+			Value: "```\n" + field.value + "```",
+		})
+	}
+
+	if cut {
+		emb.Description += "\nThe whole thing is attached."
+	}
+
+	setFooters([]*discordgo.MessageEmbed{emb}, footer)
+
+	return withFiles(emb, benchFiles(whole, cut))
+}
+
+func benchFiles(whole string, cut bool) []*discordgo.File {
+	if !cut {
+		return nil
+	}
+
+	return []*discordgo.File{{
+		Name:        "benchmarks.txt",
+		ContentType: "text/plain",
+		Reader:      strings.NewReader(whole),
+	}}
+}
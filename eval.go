@@ -0,0 +1,159 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"strconv"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// eval is the go command which prints every bare expression of the code along with its value.
+func eval(cfg *config, s *discordgo.Session, m *discordgo.Message, res *parsingResult) {
+	res.options["eval"] = true
+
+	playground(cfg, s, m, res)
+}
+
+var (
+	importerMtx sync.Mutex
+	// stdImporter reads the export data with the help of the local toolchain, it's shared to keep the loaded packages.
+	stdImporter = importer.Default()
+)
+
+// typeCheck type-checks the file as far as it goes, the info stays partial when the toolchain or
+// the imported packages are missing or the code has errors.
+func typeCheck(fset *token.FileSet, f *ast.File) *types.Info {
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+
+	conf := types.Config{
+		Importer: stdImporter,
+		Error:    func(error) {},
+	}
+
+	importerMtx.Lock()
+	defer importerMtx.Unlock()
+
+	conf.Check("main", fset, []*ast.File{f}, info)
+
+	return info
+}
+
+// valuedBuiltins are the builtins the type-checker may not know the result of, the rest has no value.
+var valuedBuiltins = map[string]bool{
+	"append": true, "cap": true, "complex": true, "imag": true, "len": true,
+	"make": true, "max": true, "min": true, "new": true, "real": true,
+}
+
+// evalExpressions makes every bare expression of the statements moved into the lazy function print
+// its source text and value. The source is the text f was parsed from.
+func evalExpressions(fset *token.FileSet, f *ast.File, source []byte) {
+	body := lazyBody(f)
+	if body == nil {
+		return
+	}
+
+	info := typeCheck(fset, f)
+
+	for _, stmt := range body.List {
+		es, ok := stmt.(*ast.ExprStmt)
+		if !ok || !hasValue(info, es.X) {
+			continue
+		}
+
+		text := string(source[fset.Position(es.X.Pos()).Offset:fset.Position(es.X.End()).Offset])
+
+		// 评估("len(s)")(len(s)), a call of several results still fits the variadic parameter
+		es.X = &ast.CallExpr{
+			Fun: &ast.CallExpr{
+				Fun:  ast.NewIdent("评估"),
+				Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(text)}},
+			},
+			Args: []ast.Expr{es.X},
+		}
+	}
+
+	astutil.AddImport(fset, f, "fmt")
+}
+
+func hasValue(info *types.Info, x ast.Expr) bool {
+	call, ok := astutil.Unparen(x).(*ast.CallExpr)
+	if !ok {
+		return true
+	}
+
+	if writerCall(info, call) {
+		return false
+	}
+
+	if tv, ok := info.Types[call]; ok && tv.Type != nil {
+		if tuple, ok := tv.Type.(*types.Tuple); ok {
+			return tuple.Len() > 0
+		}
+
+		return !tv.IsVoid()
+	}
+
+	id, ok := astutil.Unparen(call.Fun).(*ast.Ident)
+	if !ok || !valuedBuiltins[id.Name] {
+		return false
+	}
+
+	obj := info.Uses[id]
+	_, builtin := obj.(*types.Builtin)
+
+	return obj == nil || builtin
+}
+
+// writerMethods are the methods of the writers, such as the ones of io.Writer or strings.Builder.
+var writerMethods = map[string]bool{
+	"Write": true, "WriteString": true, "WriteByte": true, "WriteRune": true, "WriteTo": true, "ReadFrom": true,
+}
+
+// writerFuncs are the functions of the packages which write, by the package path.
+var writerFuncs = map[string]map[string]bool{
+	"fmt": {"Print": true, "Printf": true, "Println": true, "Fprint": true, "Fprintf": true, "Fprintln": true},
+	"io":  {"Copy": true, "CopyN": true, "CopyBuffer": true, "WriteString": true},
+}
+
+// writerCall reports whether the call writes, such as fmt.Println or b.WriteString. The calls are made for the output,
+// their n, err would only follow it as noise.
+func writerCall(info *types.Info, call *ast.CallExpr) bool {
+	sel, ok := astutil.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+
+	fn, ok := info.Uses[sel.Sel].(*types.Func)
+	if !ok {
+		return false
+	}
+
+	if fn.Type().(*types.Signature).Recv() != nil {
+		return writerMethods[fn.Name()]
+	}
+
+	return fn.Pkg() != nil && writerFuncs[fn.Pkg().Path()][fn.Name()]
+}
+
+var evalTemplate = `
+func 评估(src string) func(...interface{}) {
+	return func(values ...interface{}) {
+		fmt.Print(src, " =")
+		for i, v := range values {
+			if i > 0 {
+				fmt.Print(",")
+			}
+			fmt.Printf(" %#v", v)
+		}
+		fmt.Println()
+	}
+}
+`
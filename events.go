@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// coalesceEvents merges the adjacent events of the same kind, the playground splits the output into
+// a chunk per write. The merged messages longer than limit are split on the line boundaries, limit 0 means no limit.
+// The delay of a merged event is the one of its first chunk.
+func coalesceEvents(events []Event, limit int) []Event {
+	var merged []Event
+
+	for _, e := range events {
+		if n := len(merged); n > 0 && merged[n-1].Kind == e.Kind {
+			merged[n-1].Message += e.Message
+
+			continue
+		}
+
+		merged = append(merged, e)
+	}
+
+	if limit <= 0 {
+		return merged
+	}
+
+	var split []Event
+
+	for _, e := range merged {
+		for i, chunk := range splitLines(e.Message, limit) {
+			ev := Event{
+				Message: chunk,
+				Kind:    e.Kind,
+			}
+
+			if i == 0 {
+				ev.Delay = e.Delay
+			}
+
+			split = append(split, ev)
+		}
+	}
+
+	return split
+}
+
+// splitLines cuts the text into chunks of at most limit bytes ending with a new line,
+// the lines longer than limit are cut wherever they reach it.
+func splitLines(text string, limit int) []string {
+	var chunks []string
+
+	for len(text) > limit {
+		end := strings.LastIndexByte(text[:limit], '\n') + 1
+		if end == 0 {
+			end = limit
+			for end > 1 && !utf8.RuneStart(text[end]) {
+				end--
+			}
+		}
+
+		chunks = append(chunks, text[:end])
+		text = text[end:]
+	}
+
+	if text != "" || len(chunks) == 0 {
+		chunks = append(chunks, text)
+	}
+
+	return chunks
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Executor is a backend which compiles, runs and shares the sources prepared by CompileAndRun.
+type Executor interface {
+	// Run compiles and executes the request and returns a playground shaped response body.
+	// A body which is not a JSON object is treated as a build failure.
+	Run(req *compileRequest) ([]byte, error)
+	// Share stores the source and returns a link to it.
+	Share(src string) (string, error)
+	// Fetch returns the source of a shared snippet.
+	Fetch(id string) (string, error)
+	// Version resolves the go version asked for, empty for the default one, to the exact version which runs the code.
+	Version(version string) (string, error)
+	// RealTime reports whether the programs run with the real clock, the playground fakes the time and sleeps take none.
+	RealTime() bool
+}
+
+type compileRequest struct {
+	Body    string
+	WithVet bool
+
+	// Version is the go version asked for, it picks the backend rather than being sent.
+	Version string `json:"-"`
+}
+
+// playgroundExecutor talks to the official go playground or any server which speaks its protocol.
+type playgroundExecutor struct {
+	baseURL   string
+	linkURL   string
+	userAgent string
+	client    *http.Client
+
+	versions *versionCache
+}
+
+type playgroundSettings struct {
+	// baseURL is where the compile and share endpoints live, e.g. https://play.golang.org or https://go.dev/_
+	baseURL string
+	// linkURL prefixes the ids returned by share, baseURL + "/p/" by default.
+	linkURL   string
+	userAgent string
+	proxy     string
+	timeout   time.Duration
+}
+
+func newPlaygroundExecutor(ps playgroundSettings) (*playgroundExecutor, error) {
+	if ps.baseURL == "" {
+		ps.baseURL = "https://play.golang.org"
+	}
+
+	ps.baseURL = strings.TrimSuffix(ps.baseURL, "/")
+
+	if ps.linkURL == "" {
+		ps.linkURL = ps.baseURL + "/p/"
+	}
+
+	if ps.userAgent == "" {
+		ps.userAgent = "Go_Playground"
+	}
+
+	if ps.timeout <= 0 {
+		ps.timeout = 30 * time.Second
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if ps.proxy != "" {
+		proxy, err := url.Parse(ps.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("newPlaygroundExecutor: %v", err)
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &playgroundExecutor{
+		baseURL:   ps.baseURL,
+		linkURL:   ps.linkURL,
+		userAgent: ps.userAgent,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   ps.timeout,
+		},
+		versions: newVersionCache(time.Hour),
+	}, nil
+}
+
+func (p *playgroundExecutor) Run(req *compileRequest) ([]byte, error) {
+	backend, err := p.backend(req.Version)
+	if err != nil {
+		return nil, fmt.Errorf("playgroundExecutor.Run: %v", err)
+	}
+
+	return p.compile(req, backend)
+}
+
+func (p *playgroundExecutor) compile(req *compileRequest, backend string) ([]byte, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("playgroundExecutor.compile: %v", err)
+	}
+
+	endpoint := p.baseURL + "/compile"
+	if backend != "" {
+		endpoint += "?" + url.Values{"backend": {backend}}.Encode()
+	}
+
+	hreq, err := http.NewRequest("POST", endpoint, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("playgroundExecutor.compile: %v", err)
+	}
+
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("User-Agent", p.userAgent)
+
+	resp, err := p.client.Do(hreq)
+	if err != nil {
+		return nil, fmt.Errorf("playgroundExecutor.compile: %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("playgroundExecutor.compile: %v", err)
+	}
+
+	return b, nil
+}
+
+func (p *playgroundExecutor) RealTime() bool {
+	return false
+}
+
+func (p *playgroundExecutor) Version(version string) (string, error) {
+	backend, err := p.backend(version)
+	if err != nil {
+		return "", fmt.Errorf("playgroundExecutor.Version: %v", err)
+	}
+
+	return p.backendVersion(backend)
+}
+
+// playgroundBackends are the backends the playground serves: the latest release, the previous one and the development tip.
+var playgroundBackends = []string{"", "prev", "gotip"}
+
+// backend picks the playground backend which runs the go version asked for.
+func (p *playgroundExecutor) backend(version string) (string, error) {
+	switch version {
+	case "", "stable", "latest":
+		return "", nil
+	case "previous", "prev":
+		return "prev", nil
+	case "gotip", "tip", "dev":
+		return "gotip", nil
+	}
+
+	for _, backend := range playgroundBackends {
+		v, err := p.backendVersion(backend)
+		if err != nil {
+			return "", err
+		}
+
+		if matchVersion(v, version) {
+			return backend, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s isn't served by the playground", version)
+}
+
+func (p *playgroundExecutor) backendVersion(backend string) (string, error) {
+	return p.versions.get(backend, func() (string, error) {
+		b, err := p.compile(&compileRequest{Body: versionProbe}, backend)
+		if err != nil {
+			return "", err
+		}
+
+		var response playgroundResponse
+
+		err = json.Unmarshal(b, &response)
+		if err != nil {
+			return "", fmt.Errorf("playgroundExecutor.backendVersion: %v", err)
+		}
+
+		if response.Errors != "" || len(response.Events) == 0 {
+			return "", fmt.Errorf("playgroundExecutor.backendVersion: unable to get the version of %q: %s", backend, response.Errors)
+		}
+
+		return strings.TrimSpace(response.Events[0].Message), nil
+	})
+}
+
+func (p *playgroundExecutor) Share(src string) (string, error) {
+	req, err := http.NewRequest("POST", p.baseURL+"/share", bytes.NewBufferString(src))
+	if err != nil {
+		return "", fmt.Errorf("playgroundExecutor.Share: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+	req.Header.Set("User-Agent", p.userAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("playgroundExecutor.Share: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("playgroundExecutor.Share: got non-200 response: %s", resp.Status)
+	}
+
+	linkID, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("playgroundExecutor.Share: %v", err)
+	}
+
+	return p.linkURL + b2s(linkID), nil
+}
+
+func (p *playgroundExecutor) Fetch(id string) (string, error) {
+	req, err := http.NewRequest("GET", p.linkURL+url.PathEscape(id)+".go", nil)
+	if err != nil {
+		return "", fmt.Errorf("playgroundExecutor.Fetch: %v", err)
+	}
+
+	req.Header.Set("User-Agent", p.userAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("playgroundExecutor.Fetch: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("playgroundExecutor.Fetch: got non-200 response: %s", resp.Status)
+	}
+
+	src, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSnippetSize))
+	if err != nil {
+		return "", fmt.Errorf("playgroundExecutor.Fetch: %v", err)
+	}
+
+	return string(src), nil
+}
+
+const maxSnippetSize = 64 << 10
+
+// snippetID extracts the snippet id out of a playground link or a bare id.
+func snippetID(content string) (string, bool) {
+	content = strings.TrimSpace(content)
+	if content == "" || strings.ContainsAny(content, " \t\n\r`") {
+		return "", false
+	}
+
+	if isLink(content) {
+		u, err := url.Parse(content)
+		if err != nil {
+			return "", false
+		}
+
+		i := strings.LastIndex(u.Path, "/p/")
+		if i == -1 {
+			return "", false
+		}
+
+		content = strings.TrimSuffix(u.Path[i+len("/p/"):], ".go")
+	} else if len(content) < 6 {
+		return "", false
+	}
+
+	for _, r := range content {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return "", false
+		}
+	}
+
+	return content, content != ""
+}
+
+func isLink(content string) bool {
+	content = strings.TrimSpace(content)
+
+	return strings.HasPrefix(content, "https://") || strings.HasPrefix(content, "http://")
+}
+
+const versionProbe = `package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func main() {
+	fmt.Print(runtime.Version())
+}
+`
+
+// matchVersion reports whether the exact version, e.g. go1.22.5, is what the user asked for with go1.22 or 1.22.5.
+func matchVersion(exact, version string) bool {
+	if !strings.HasPrefix(version, "go") {
+		version = "go" + version
+	}
+
+	return exact == version || strings.HasPrefix(exact, version+".")
+}
+
+// versionCache remembers which go version answers to what for a while, since the backends get updated.
+type versionCache struct {
+	mtx     sync.Mutex
+	ttl     time.Duration
+	entries map[string]versionEntry
+}
+
+type versionEntry struct {
+	version string
+	expires time.Time
+}
+
+func newVersionCache(ttl time.Duration) *versionCache {
+	return &versionCache{
+		ttl:     ttl,
+		entries: make(map[string]versionEntry),
+	}
+}
+
+func (c *versionCache) get(key string, resolve func() (string, error)) (string, error) {
+	c.mtx.Lock()
+	e, ok := c.entries[key]
+	c.mtx.Unlock()
+
+	if ok && time.Now().Before(e.expires) {
+		return e.version, nil
+	}
+
+	version, err := resolve()
+	if err != nil {
+		return "", err
+	}
+
+	c.mtx.Lock()
+	c.entries[key] = versionEntry{version, time.Now().Add(c.ttl)}
+	c.mtx.Unlock()
+
+	return version, nil
+}
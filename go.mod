@@ -3,6 +3,6 @@ module main
 go 1.16
 
 require (
-	github.com/bwmarrin/discordgo v0.23.2
+	github.com/bwmarrin/discordgo v0.24.0
 	golang.org/x/tools v0.1.5
 )
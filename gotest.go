@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// hasTests reports whether the file declares any func TestXxx(*testing.T).
+func hasTests(f *ast.File) bool {
+	for _, d := range f.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || !strings.HasPrefix(fn.Name.Name, "Test") {
+			continue
+		}
+
+		if isTestingParam(fn.Type, "T") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTestingParam reports whether the func takes a single *testing.<typ>.
+func isTestingParam(ft *ast.FuncType, typ string) bool {
+	if ft.Params == nil || len(ft.Params.List) != 1 || len(ft.Params.List[0].Names) > 1 {
+		return false
+	}
+
+	star, ok := ft.Params.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+
+	pkg, ok := sel.X.(*ast.Ident)
+
+	return ok && pkg.Name == "testing" && sel.Sel.Name == typ
+}
+
+// isTestProgram tells apart the sources which the playground runs with go test: tests and no main.
+func isTestProgram(src string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "prog.go", src, 0)
+	if err != nil {
+		return false
+	}
+
+	return !hasFunc(f, "main") && hasTests(f)
+}
+
+type testResult struct {
+	name   string
+	status string // "PASS", "FAIL" or "SKIP", empty if the test never finished
+	logs   []string
+}
+
+type testReport struct {
+	tests  []*testResult
+	run    int
+	passed int
+	failed int
+	skip   int
+	// notes holds the notes the bot added to the output, such as the removed imports.
+	notes string
+}
+
+// parseTestOutput collects the verbose go test output into per test results.
+// The logs are streamed right after === RUN since go1.14 and printed after --- FAIL before, so both places are tracked.
+// The parallel tests take turns, === CONT and === NAME since go1.20 tell whose logs follow.
+func parseTestOutput(events []Event) *testReport {
+	report := &testReport{}
+
+	var out strings.Builder
+	for _, e := range events {
+		if e.Kind == "note" {
+			report.notes += e.Message
+
+			continue
+		}
+
+		out.WriteString(e.Message)
+	}
+	byName := make(map[string]*testResult)
+
+	var current *testResult
+
+	lookup := func(name string) *testResult {
+		t, ok := byName[name]
+		if !ok {
+			t = &testResult{name: name}
+			byName[name] = t
+			report.tests = append(report.tests, t)
+		}
+
+		return t
+	}
+
+	for _, line := range strings.Split(out.String(), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "=== RUN"), strings.HasPrefix(trimmed, "=== CONT"), strings.HasPrefix(trimmed, "=== NAME"):
+			fields := strings.Fields(trimmed)
+			if len(fields) < 3 {
+				continue
+			}
+
+			current = lookup(fields[2])
+		case strings.HasPrefix(trimmed, "=== "):
+		case strings.HasPrefix(trimmed, "--- "):
+			fields := strings.Fields(trimmed)
+			if len(fields) < 3 {
+				continue
+			}
+
+			current = lookup(fields[2])
+			current.status = strings.TrimSuffix(fields[1], ":")
+		case current != nil && strings.HasPrefix(line, "    "):
+			current.logs = append(current.logs, trimmed)
+		}
+	}
+
+	for _, t := range report.tests {
+		// subtests are counted with their parents
+		if strings.Contains(t.name, "/") {
+			continue
+		}
+
+		report.run++
+
+		switch t.status {
+		case "PASS":
+			report.passed++
+		case "SKIP":
+			report.skip++
+		default:
+			report.failed++
+		}
+	}
+
+	return report
+}
+
+func (r *testReport) summary() string {
+	s := fmt.Sprintf("ran %d, passed %d, failed %d", r.run, r.passed, r.failed)
+	if r.skip > 0 {
+		s += fmt.Sprintf(", skipped %d", r.skip)
+	}
+
+	return s
+}
+
+// failures returns the tests which didn't pass, subtests included.
+func (r *testReport) failures() []*testResult {
+	var failed []*testResult
+	for _, t := range r.tests {
+		if t.status != "PASS" && t.status != "SKIP" {
+			failed = append(failed, t)
+		}
+	}
+
+	return failed
+}
+
+const (
+	colorPassed = 0x2ecc71
+	colorFailed = 0xe74c3c
+)
+
+// renderTests renders the report of the tests, the output and the errors which don't fit are attached.
+func renderTests(response *playgroundResponse, plain bool, footer string) interface{} {
+	report := parseTestOutput(response.Events)
+	failed := response.TestsFailed > 0 || report.failed > 0 || response.Status != 0
+
+	if plain {
+		result := ""
+		cut := false
+		for _, t := range report.failures() {
+			if len(result) >= 2000 {
+				cut = true
+
+				break
+			}
+
+			result = fmt.Sprintf("%s--- FAIL: %s\n", result, t.name)
+			for _, l := range t.logs {
+				result += "    " + l + "\n"
+			}
+		}
+
+		if len(response.Errors) > 0 {
+			result = response.Errors + result
+		}
+
+		result = report.notes + result
+
+		if result == "" {
+			result = "ok"
+		}
+
+		const plainTestsTemplate = "*Tests*: %s\n```\n%s\n```"
+
+		if len(result) > 2000-len(plainTestsTemplate)-len(report.summary()) {
+			result = result[:2000-len(plainTestsTemplate)-len(report.summary())]
+			cut = true
+		}
+
+		return withFiles(fmt.Sprintf(plainTestsTemplate, report.summary(), result), outputFiles(response, cut, cut))
+	}
+
+	var (
+		fields               []*discordgo.MessageEmbedField
+		outputCut, errorsCut bool
+	)
+
+	if len(response.Errors) > 0 {
+		errs := response.Errors
+		if len(errs) > 1024-len("```\n```") {
+			errs = errs[:1024-len("```\n```")]
+			errorsCut = true
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "errors",
+			Value: "```\n" + errs + "```",
+		})
+	}
+
+	for _, t := range report.failures() {
+		logs := strings.Join(t.logs, "\n")
+		if logs == "" {
+			logs = "no output"
+		}
+
+		if len(logs) > 1024-len("```\n\n```") {
+			logs = logs[:1024-len("```\n\n```")]
+			outputCut = true
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "FAIL: " + t.name,
+			Value: "```\n" + logs + "\n```",
+		})
+	}
+
+	description := strings.TrimSuffix(report.summary()+"\n"+report.notes, "\n")
+
+	pages, pagesCut := paginate("Tests:", description, fields)
+	outputCut = outputCut || pagesCut
+
+	if outputCut || errorsCut {
+		pages[0].Description += "\nThe whole thing is attached."
+	}
+
+	for _, page := range pages {
+		page.Color = colorPassed
+		if failed {
+			page.Color = colorFailed
+		}
+	}
+
+	setFooters(pages, footer)
+
+	var reply interface{} = pages[0]
+	if len(pages) > 1 {
+		reply = newPagedReply(pages)
+	}
+
+	return withFiles(reply, outputFiles(response, outputCut, errorsCut))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// The playground shows the stdout lines of IMAGE: followed by a base64 PNG as images, the bot attaches them.
+
+const (
+	imagePrefix = "IMAGE:"
+	// maxImages keeps the images and the output files under the attachment limit of a message.
+	maxImages = 8
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+// extractImages takes the images out of stdout, the lines which aren't valid images stay there.
+func extractImages(events []Event) ([]Event, []*discordgo.File) {
+	if !hasImages(events) {
+		return events, nil
+	}
+
+	var (
+		rest   []Event
+		images []*discordgo.File
+	)
+
+	// an image line is usually split into several writes
+	for _, e := range coalesceEvents(events, 0) {
+		if e.Kind != "stdout" {
+			rest = append(rest, e)
+
+			continue
+		}
+
+		var text strings.Builder
+		for _, line := range strings.SplitAfter(e.Message, "\n") {
+			if !strings.HasPrefix(line, imagePrefix) || len(images) == maxImages {
+				text.WriteString(line)
+
+				continue
+			}
+
+			data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line[len(imagePrefix):]))
+			if err != nil || !bytes.HasPrefix(data, pngHeader) {
+				text.WriteString(line)
+
+				continue
+			}
+
+			images = append(images, &discordgo.File{
+				Name:        fmt.Sprintf("image%d.png", len(images)+1),
+				ContentType: "image/png",
+				Reader:      bytes.NewReader(data),
+			})
+		}
+
+		if text.Len() > 0 {
+			e.Message = text.String()
+			rest = append(rest, e)
+		}
+	}
+
+	return rest, images
+}
+
+func hasImages(events []Event) bool {
+	for _, e := range events {
+		if e.Kind == "stdout" && strings.Contains(e.Message, imagePrefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// imageEmbed shows the first image inside the embed, the rest are shown under it as attachments.
+func imageEmbed(emb *discordgo.MessageEmbed, images []*discordgo.File) {
+	if len(images) > 0 {
+		emb.Image = &discordgo.MessageEmbedImage{
+			URL: "attachment://" + images[0].Name,
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// The imports are resolved before the code is sent anywhere: a package name which isn't declared
+// is looked up among std and the well-known packages, the candidates are loaded by the type-checker
+// and the one declaring the selectors the code uses wins, so rand.Intn gets math/rand and rand.Reader crypto/rand.
+
+// preferredImports break the ties between the packages of the same name which declare all the selectors used.
+var preferredImports = map[string]string{
+	"rand":     "math/rand",
+	"template": "text/template",
+	"scanner":  "text/scanner",
+}
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// importName guesses the package name of the import path, the major version suffixes such as math/rand/v2 aside.
+func importName(p string) string {
+	for _, mp := range modulePackages {
+		if mp.path == p {
+			return mp.name
+		}
+	}
+
+	name := path.Base(p)
+	if dir := path.Dir(p); majorVersion.MatchString(name) && dir != "." {
+		name = path.Base(dir)
+	}
+
+	return name
+}
+
+// importedNames returns the names the imports of the file are known by, the blank and dot imports aside.
+func importedNames(f *ast.File) map[string]*ast.ImportSpec {
+	names := make(map[string]*ast.ImportSpec)
+
+	for _, s := range f.Imports {
+		name := importName(importPath(s))
+		if s.Name != nil {
+			name = s.Name.Name
+		}
+
+		if name != "_" && name != "." {
+			names[name] = s
+		}
+	}
+
+	return names
+}
+
+// packageSelectors collects the selectors used on every undeclared name, such as Intn of rand.Intn.
+func packageSelectors(f *ast.File) map[string][]string {
+	unresolved := make(map[string]bool)
+	for _, id := range f.Unresolved {
+		unresolved[id.Name] = true
+	}
+
+	selectors := make(map[string][]string)
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil && unresolved[id.Name] {
+			selectors[id.Name] = append(selectors[id.Name], sel.Sel.Name)
+		}
+
+		return true
+	})
+
+	return selectors
+}
+
+// importPackage loads the package with the shared importer, nil is returned if it's not around.
+func importPackage(p string) *types.Package {
+	importerMtx.Lock()
+	defer importerMtx.Unlock()
+
+	pkg, err := stdImporter.Import(p)
+	if err != nil {
+		return nil
+	}
+
+	return pkg
+}
+
+// choosePackage returns the import path of the package the name and its selectors most likely refer to.
+func choosePackage(name string, selectors, std []string) (string, bool) {
+	var candidates []string
+
+	for _, imp := range std {
+		if importName(imp) == name {
+			candidates = append(candidates, imp)
+		}
+	}
+
+	if mp, ok := findModulePackage(name); ok {
+		candidates = append(candidates, mp.path)
+	}
+
+	best, bestScore := "", -1
+
+	for _, c := range candidates {
+		score := 0
+
+		if pkg := importPackage(c); pkg != nil {
+			for _, sel := range selectors {
+				if obj := pkg.Scope().Lookup(sel); obj != nil && obj.Exported() {
+					score++
+				}
+			}
+		}
+
+		if score > bestScore || score == bestScore && preferredImports[name] == c {
+			best, bestScore = c, score
+		}
+	}
+
+	return best, best != ""
+}
+
+// addMissingImports imports the packages of std and the well-known ones named by the undeclared selectors of the file.
+func addMissingImports(fset *token.FileSet, f *ast.File, std []string) {
+	imported := importedNames(f)
+
+	for name, selectors := range packageSelectors(f) {
+		if _, ok := imported[name]; ok {
+			continue
+		}
+
+		if imp, ok := choosePackage(name, selectors, std); ok {
+			astutil.AddImport(fset, f, imp)
+		}
+	}
+}
+
+// removeUnusedImports deletes the imports no selector of the file uses and returns their paths.
+// The imports of the packages the name of which is only guessed are kept, as well as the blank and dot ones.
+func removeUnusedImports(fset *token.FileSet, f *ast.File, std []string) []string {
+	used := make(map[string]bool)
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+
+		return true
+	})
+
+	var removed []string
+
+	for name, s := range importedNames(f) {
+		p := importPath(s)
+		if used[name] || p == "C" || s.Name == nil && !knownImport(p, std) {
+			continue
+		}
+
+		if astutil.DeleteNamedImport(fset, f, nameOf(s), p) {
+			removed = append(removed, p)
+		}
+	}
+
+	sort.Strings(removed)
+
+	return removed
+}
+
+func knownImport(p string, std []string) bool {
+	for _, imp := range std {
+		if imp == p {
+			return true
+		}
+	}
+
+	for _, mp := range modulePackages {
+		if mp.path == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+func nameOf(s *ast.ImportSpec) string {
+	if s.Name == nil {
+		return ""
+	}
+
+	return s.Name.Name
+}
+
+var unusedImportRe = regexp.MustCompile(`prog(?:_test)?\.go:\d+(?::\d+)?: (?:"([^"]+)" imported (?:as \S+ )?and not used|imported and not used: "([^"]+)")`)
+
+// unusedImportFixes reads the imports the compiler found unused in the main file out of the response,
+// the ones removeUnusedImports couldn't tell. It returns the fixes deleting them, a fix records the path
+// into removed once it deleted the import, so the imports no retry took out aren't reported as removed.
+func unusedImportFixes(b []byte, removed map[string]bool) []func(fset *token.FileSet, f *ast.File) {
+	errs := string(b)
+
+	if len(b) > 0 && b[0] == '{' {
+		var res playgroundResponse
+
+		err := json.Unmarshal(b, &res)
+		if err != nil {
+			return nil
+		}
+
+		errs = res.Errors
+	}
+
+	var fixes []func(fset *token.FileSet, f *ast.File)
+
+	for _, match := range unusedImportRe.FindAllStringSubmatch(errs, -1) {
+		p := match[1] + match[2]
+		if removed[p] {
+			continue
+		}
+
+		fixes = append(fixes, func(fset *token.FileSet, f *ast.File) {
+			if deleteImport(fset, f, p) {
+				removed[p] = true
+			}
+		})
+	}
+
+	return fixes
+}
+
+// deleteImport deletes every import of the path, whatever it's named, it reports whether there was any.
+func deleteImport(fset *token.FileSet, f *ast.File, p string) bool {
+	deleted := false
+
+	for _, s := range append([]*ast.ImportSpec(nil), f.Imports...) {
+		if importPath(s) == p && astutil.DeleteNamedImport(fset, f, nameOf(s), p) {
+			deleted = true
+		}
+	}
+
+	return deleted
+}
+
+// unusedImportsNote tells the imports removed from the code, so the lesson isn't lost.
+func unusedImportsNote(removed []string) string {
+	var b strings.Builder
+	for _, p := range removed {
+		fmt.Fprintf(&b, "%q imported and not used, removed it.\n", p)
+	}
+
+	return b.String()
+}
+
+// removedImports joins the imports of the last local pass and the ones the compiler found, sorted.
+func removedImports(local []string, compiler map[string]bool) []string {
+	all := append([]string(nil), local...)
+	for p := range compiler {
+		all = append(all, p)
+	}
+
+	sort.Strings(all)
+
+	return all
+}
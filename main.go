@@ -16,10 +16,20 @@ import (
 )
 
 var dtoken string = os.Getenv("DISCORD_TOKEN")
+var executorName string = os.Getenv("EXECUTOR")
+
+var playgroundURL string = os.Getenv("PLAYGROUND_URL")
+var playgroundLinkURL string = os.Getenv("PLAYGROUND_LINK_URL")
+var playgroundProxy string = os.Getenv("PLAYGROUND_PROXY")
+var playgroundUserAgent string = os.Getenv("PLAYGROUND_USER_AGENT")
+var playgroundTimeout string = os.Getenv("PLAYGROUND_TIMEOUT")
+
+var modulePackagesFile string = os.Getenv("MODULE_PACKAGES")
 
 type config struct {
 	prefix   string
 	botID    string
+	executor Executor
 	commands map[string]func(*config, *discordgo.Session, *discordgo.Message, *parsingResult)
 }
 
@@ -31,32 +41,159 @@ func playground(cfg *config, s *discordgo.Session, m *discordgo.Message, res *pa
 		return
 	}
 
-	debug := findBoolOption(res.options, "debug", "d", "explain", "e")
-	b, err := CompileAndRun(res.content, debug)
+	content, err := withAttachments(res.content, m)
+	if err != nil {
+		log.Println(err)
+		sendDeletable(s, m, fmt.Sprintf("```\n%v\n```", err), 5*time.Minute)
+
+		return
+	}
+
+	// a snippet is fetched by its link or by the id given with -snippet, a bare word is run as it is
+	id, ok := snippetID(findStringOption(res.options, "snippet"))
+	if !ok && isLink(res.content) {
+		id, ok = snippetID(res.content)
+	}
+
+	if content != res.content {
+		res.content = content
+	} else if ok {
+		src, err := cfg.executor.Fetch(id)
+		if err != nil {
+			log.Println(err)
+			sendDeletable(s, m, fmt.Sprintf("```\nCouldn't get the snippet %s, is it right?\n```", id), 5*time.Minute)
+
+			return
+		}
+
+		// the snippet may have raw strings in it, so findCodeBlock has to see it as a code block
+		res.content = "```go\n" + src + "\n```"
+	} else if name := findStringOption(res.options, "snippet"); name != "" {
+		sendDeletable(s, m, fmt.Sprintf("```\n%s isn't a snippet id, it's the part of the link after /p/.\n```", name), 5*time.Minute)
+
+		return
+	}
+
+	opts := runOptions{
+		debug:   findBoolOption(res.options, "debug", "d", "explain", "e"),
+		version: findStringOption(res.options, "version", "v"),
+		vet:     findBoolOption(res.options, "vet"),
+		test:    findBoolOption(res.options, "test", "t"),
+		bench:   findStringOption(res.options, "bench", "b"),
+		eval:    findBoolOption(res.options, "eval"),
+		clock:   findStringOption(res.options, "time"),
+	}
+
+	if opts.bench == "" && findBoolOption(res.options, "bench", "b") {
+		opts.bench = "."
+	}
+
+	goVersion, err := cfg.executor.Version(opts.version)
+	if err != nil {
+		log.Println(err)
+
+		if opts.version != "" {
+			sendDeletable(s, m, fmt.Sprintf("```\nThere's no %s around here, try another go version.\n```", opts.version), 5*time.Minute)
+
+			return
+		}
+	}
+
+	result, err := CompileAndRun(cfg.executor, res.content, opts)
 	if err != nil {
 		sendDeletable(s, m, fmt.Sprintf("```\n%v```", err), 5*time.Minute)
+
+		return
+	}
+
+	var link string
+
+	if findBoolOption(res.options, "share", "s") {
+		link, err = PostToPlayground(cfg.executor, result.source)
+		if err != nil {
+			log.Println(err)
+		}
 	}
 
 	var response playgroundResponse
 
-	err = json.Unmarshal(b, &response)
+	err = json.Unmarshal(result.response, &response)
 	if err != nil {
 		log.Println(err)
 
 		return
 	}
 
+	// the footer tells the go version and the clock the program ran with
+	footer := goVersion
+	if result.clock != "" {
+		footer = strings.TrimPrefix(footer+" · "+result.clock, " · ")
+	}
+
+	var images []*discordgo.File
+
+	response.Events, images = extractImages(response.Events)
+
+	// the removed imports are reported along with the output, so the lesson isn't lost
+	note := unusedImportsNote(result.removed)
+
+	if findBoolOption(res.options, "color", "c") && (response.Errors != "" || !response.IsTest && opts.bench == "") {
+		response.Events = withNote(response.Events, note)
+		reply := withFiles(renderANSI(&response, result.original, opts.vet, link), images)
+
+		sendDeletable(s, m, withLink(reply, link), 5*time.Minute)
+
+		return
+	}
+
 	if len(response.Errors) > 0 && len(response.Events) == 0 {
-		sendDeletable(s, m, fmt.Sprintf("```go\n%v```", response.Errors), 5*time.Minute)
+		errs := note + response.Errors
+		cut := len(errs) > 2000-len("```go\n```")-len(link)-len("\n")
+		if cut {
+			errs = errs[:2000-len("```go\n```")-len(link)-len("\n")]
+		}
+
+		reply := withFiles(fmt.Sprintf("```go\n%v```", errs), outputFiles(&response, false, cut))
+
+		sendDeletable(s, m, withLink(reply, link), 5*time.Minute)
 
 		return
 	}
 
+	response.Events = withNote(response.Events, note)
+
 	plain := findBoolOption(res.options, "plain", "p")
+
+	if opts.bench != "" {
+		benchmarks := renderBenchmarks(&response, plain, footer)
+
+		sendDeletable(s, m, withLink(withFiles(benchmarks, images), link), 5*time.Minute)
+
+		return
+	}
+
+	if findBoolOption(res.options, "animate", "a") && !response.IsTest && response.Errors == "" && len(response.Events) > 0 && len(images) == 0 {
+		animate(s, m, response.Events, link)
+
+		return
+	}
+
+	if response.IsTest {
+		tests := renderTests(&response, plain, footer)
+
+		sendDeletable(s, m, withLink(withFiles(tests, images), link), 5*time.Minute)
+
+		return
+	}
+
 	if plain {
+		clock := result.clock
 		result := ""
-		for _, e := range response.Events {
+		cut := false
+		for _, e := range coalesceEvents(response.Events, 0) {
 			if len(result) >= 2000 {
+				cut = true
+
 				break
 			}
 
@@ -67,7 +204,7 @@ func playground(cfg *config, s *discordgo.Session, m *discordgo.Message, res *pa
 			result = fmt.Sprintf("%s\n_%s_\n%s\n", result, e.Kind, e.Message)
 		}
 
-		if len(response.Events) == 0 {
+		if len(response.Events) == 0 && len(images) == 0 {
 			result = "There's nothing to print out.\nReact with 😐 to delete this message."
 		}
 
@@ -75,31 +212,48 @@ func playground(cfg *config, s *discordgo.Session, m *discordgo.Message, res *pa
 			result = response.Errors + result
 		}
 
+		if opts.vet {
+			result = fmt.Sprintf("_vet_\n%s\n%s", vetReport(&response), result)
+		}
+
+		if clock != "" {
+			result = fmt.Sprintf("_%s_\n%s", clock, result)
+		}
+
 		const plainOutputTempalte = "*Result*:\n```\n%s\n```"
 
-		if len(result) > 2000-len(plainOutputTempalte) {
-			result = result[:2000-len(plainOutputTempalte)]
+		if len(result) > 2000-len(plainOutputTempalte)-len(link)-len("\n") {
+			result = result[:2000-len(plainOutputTempalte)-len(link)-len("\n")]
+			cut = true
 		}
 
 		result = fmt.Sprintf(plainOutputTempalte, result)
 
-		sendDeletable(s, m, result, 5*time.Minute)
+		reply := withFiles(result, append(outputFiles(&response, cut, cut), images...))
+
+		sendDeletable(s, m, withLink(reply, link), 5*time.Minute)
 
 		return
 	}
 
-	length := 0
-	emb := &discordgo.MessageEmbed{
-		Title: "Result:",
-	}
+	cut := false
+
+	var fields []*discordgo.MessageEmbedField
 
-	length += len("Result:")
+	if opts.vet {
+		vet := vetReport(&response)
+		if len(vet) > 1024-len("```\n```") {
+			vet = vet[:1024-len("```\n```")]
+		}
 
-	for _, e := range response.Events {
-		switch {
-		case len(e.Message) > 1024:
-			e.Message = e.Message[:1024]
-		case len(e.Message) == 0:
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "vet",
+			Value: "```\n" + vet + "```",
+		})
+	}
+
+	for _, e := range coalesceEvents(response.Events, 1024) {
+		if len(e.Message) == 0 {
 			continue
 		}
 
@@ -107,40 +261,187 @@ func playground(cfg *config, s *discordgo.Session, m *discordgo.Message, res *pa
 			continue
 		}
 
-		length += len(e.Kind)
-		length += len(e.Message)
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  e.Kind,
+			Value: e.Message,
+		})
+	}
+
+	if len(response.Events) == 0 && len(images) == 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "success",
+			Value: "There's nothing to print out.\nReact with 😐 to delete this message.",
+		})
+	}
+
+	description := ""
+	errorsCut := false
+	if len(response.Errors) > 0 && len(response.Errors) <= 4096-len("```go\n\n```")-len("\nThe whole thing is attached.") {
+		description = fmt.Sprintf("```go\n%s\n```", response.Errors)
+	} else if len(response.Errors) > 0 {
+		errorsCut = true
+	}
+
+	pages, pagesCut := paginate("Result:", description, fields)
+	cut = cut || pagesCut
 
-		if length > 6000-len("Message is too long...") {
-			emb.Description = "Message is too long..."
-			length += len(e.Message)
+	if cut || errorsCut {
+		pages[0].Description += "\nThe whole thing is attached."
+	}
+
+	setFooters(pages, footer)
+	imageEmbed(pages[0], images)
+
+	var reply interface{} = pages[0]
+	if len(pages) > 1 {
+		reply = newPagedReply(pages)
+	}
+
+	reply = withFiles(reply, append(outputFiles(&response, cut, errorsCut), images...))
+
+	sendDeletable(s, m, withLink(reply, link), 5*time.Minute)
+}
 
-			break
+// withNote puts the note in front of the output, as an event of its own kind.
+func withNote(events []Event, note string) []Event {
+	if note == "" {
+		return events
+	}
+
+	return append([]Event{{Message: note, Kind: "note"}}, events...)
+}
+
+// outputFiles attaches the whole output and the compile errors which didn't fit into the reply.
+func outputFiles(response *playgroundResponse, output, errors bool) []*discordgo.File {
+	var files []*discordgo.File
+
+	if output && len(response.Events) > 0 {
+		var b strings.Builder
+		for _, e := range response.Events {
+			b.WriteString(e.Message)
 		}
 
-		emb.Fields = append(emb.Fields, &discordgo.MessageEmbedField{
-			Name:  e.Kind,
-			Value: e.Message,
+		files = append(files, &discordgo.File{
+			Name:        "output.txt",
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(b.String()),
 		})
+	}
 
-		if len(emb.Fields) == 25 {
-			emb.Description = "The maximum field amount is 25.\nThe result will be cut off..."
+	if errors && response.Errors != "" {
+		files = append(files, &discordgo.File{
+			Name:        "errors.txt",
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(response.Errors),
+		})
+	}
 
-			break
-		}
+	return files
+}
+
+func asMessageSend(content interface{}) *discordgo.MessageSend {
+	switch c := content.(type) {
+	case string:
+		return &discordgo.MessageSend{Content: c}
+	case *discordgo.MessageEmbed:
+		return &discordgo.MessageSend{Embed: c}
+	case *discordgo.MessageSend:
+		return c
+	case *pagedReply:
+		return c.MessageSend
 	}
 
-	if len(response.Errors) > 0 && len(response.Errors)+length < 6000 {
-		emb.Description = fmt.Sprintf("```go\n%s\n```", response.Errors)
+	return nil
+}
+
+func withFiles(content interface{}, files []*discordgo.File) interface{} {
+	if len(files) == 0 {
+		return content
 	}
 
-	if len(response.Events) == 0 {
-		emb.Fields = append(emb.Fields, &discordgo.MessageEmbedField{
-			Name:  "success",
-			Value: "There's nothing to print out.\nReact with 😐 to delete this message.",
-		})
+	msg := asMessageSend(content)
+	if msg == nil {
+		return content
+	}
+
+	msg.Files = append(msg.Files, files...)
+
+	if _, ok := content.(*pagedReply); ok {
+		return content
+	}
+
+	return msg
+}
+
+func vetReport(response *playgroundResponse) string {
+	if response.VetErrors != "" {
+		return response.VetErrors
+	}
+
+	if response.VetOK {
+		return "No issues found.\n"
+	}
+
+	return "Vet didn't run.\n"
+}
+
+func share(cfg *config, s *discordgo.Session, m *discordgo.Message, res *parsingResult) {
+	content, err := withAttachments(res.content, m)
+	if err != nil {
+		log.Println(err)
+		sendDeletable(s, m, fmt.Sprintf("```\n%v\n```", err), 5*time.Minute)
+
+		return
+	}
+
+	result, err := PrepareSource(cfg.executor, content, runOptions{})
+	if err != nil {
+		sendDeletable(s, m, fmt.Sprintf("```\n%v```", err), 5*time.Minute)
+
+		return
+	}
+
+	link, err := PostToPlayground(cfg.executor, result.source)
+	if err != nil {
+		log.Println(err)
+		sendDeletable(s, m, "```\nThe playground refused to keep it, try again later.\n```", 5*time.Minute)
+
+		return
+	}
+
+	sendDeletable(s, m, link, 5*time.Minute)
+}
+
+// withLink puts the share link on top of the reply content.
+func withLink(content interface{}, link string) interface{} {
+	if link == "" {
+		return content
+	}
+
+	if c, ok := content.(string); ok {
+		return link + "\n" + c
+	}
+
+	msg := asMessageSend(content)
+	if msg == nil {
+		return content
 	}
 
-	sendDeletable(s, m, emb, 5*time.Minute)
+	if msg.Embed != nil {
+		msg.Embed.URL = link
+	}
+
+	msg.Content = strings.TrimSuffix(link+"\n"+msg.Content, "\n")
+
+	if p, ok := content.(*pagedReply); ok {
+		for _, page := range p.pages {
+			page.URL = link
+		}
+
+		return content
+	}
+
+	return msg
 }
 
 func commandHandler(cfg *config, s *discordgo.Session, msg interface{}) func() {
@@ -199,13 +500,59 @@ func help(cfg *config, s *discordgo.Session, m *discordgo.Message, res *parsingR
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == jailCommand {
+		runJailed(os.Args[2:])
+	}
+
 	cfg := &config{
 		prefix: "!",
 	}
 
+	timeout, err := parseDurationEnv(playgroundTimeout)
+	if err != nil {
+		log.Println("PLAYGROUND_TIMEOUT:", err)
+
+		return
+	}
+
+	cfg.executor, err = newPlaygroundExecutor(playgroundSettings{
+		baseURL:   strings.TrimSpace(playgroundURL),
+		linkURL:   strings.TrimSpace(playgroundLinkURL),
+		userAgent: strings.TrimSpace(playgroundUserAgent),
+		proxy:     strings.TrimSpace(playgroundProxy),
+		timeout:   timeout,
+	})
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	if file := strings.TrimSpace(modulePackagesFile); file != "" {
+		err = loadModulePackages(file)
+		if err != nil {
+			log.Println(err)
+
+			return
+		}
+	}
+
+	// without a toolchain around the embedded list of std is used
+	err = loadStdImports()
+	if err != nil {
+		log.Println(err)
+	}
+
+	if strings.TrimSpace(executorName) == "local" {
+		cfg.executor = newLocalExecutor()
+	}
+
 	cfg.commands = make(map[string]func(*config, *discordgo.Session, *discordgo.Message, *parsingResult))
 	cfg.commands["go"] = playground
 	cfg.commands["help"] = help
+	cfg.commands["share"] = share
+	cfg.commands["eval"] = eval
+	cfg.commands["repl"] = repl
 	cfg.commands["source"] = func(c *config, session *discordgo.Session, create *discordgo.Message, result *parsingResult) {
 		sendDeletable(session, create, "```\nhttps://github.com/LaevusDexter/go-playground-bot```", 5*time.Minute)
 	}
@@ -317,6 +664,15 @@ func main() {
 	<-sig
 }
 
+func parseDurationEnv(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(v)
+}
+
 func findBoolOption(m map[string]interface{}, variants ...string) bool {
 	for _, v := range variants {
 		r, ok := m[v].(bool)
@@ -328,7 +684,19 @@ func findBoolOption(m map[string]interface{}, variants ...string) bool {
 	return false
 }
 
-func sendDeletable(s *discordgo.Session, ctx *discordgo.Message, content interface{}, delay time.Duration) {
+func findStringOption(m map[string]interface{}, variants ...string) string {
+	for _, v := range variants {
+		r, ok := m[v].(string)
+		if ok {
+			return strings.TrimSpace(r)
+		}
+	}
+
+	return ""
+}
+
+// sendDeletable replies with the content which the author or the herders can delete, the sent message is returned.
+func sendDeletable(s *discordgo.Session, ctx *discordgo.Message, content interface{}, delay time.Duration) *discordgo.Message {
 	var (
 		msg *discordgo.Message
 		err error
@@ -351,18 +719,25 @@ func sendDeletable(s *discordgo.Session, ctx *discordgo.Message, content interfa
 			Embed:     c,
 			Reference: ref,
 		})
+	case *discordgo.MessageSend:
+		c.Reference = ref
+		msg, err = s.ChannelMessageSendComplex(ctx.ChannelID, c)
+	case *pagedReply:
+		c.Reference = ref
+		msg, err = s.ChannelMessageSendComplex(ctx.ChannelID, c.MessageSend)
 	default:
-		return
+		return nil
 	}
 
 	if err != nil {
 		log.Println("sendDeletable:", err)
 
-		return
+		return nil
 	}
 
 	var (
 		cancel1, cancel2, cancel3 func()
+		cancel4, expire           = func() {}, func() {}
 	)
 
 	mtx := &sync.Mutex{}
@@ -375,6 +750,7 @@ func sendDeletable(s *discordgo.Session, ctx *discordgo.Message, content interfa
 			cancel1()
 			cancel2()
 			cancel3()
+			cancel4()
 
 			canceled = true
 
@@ -426,9 +802,18 @@ func sendDeletable(s *discordgo.Session, ctx *discordgo.Message, content interfa
 		}
 	})
 
+	if p, ok := content.(*pagedReply); ok {
+		cancel4, expire = handlePages(s, msg, p.pages)
+	}
+
 	time.AfterFunc(delay, func() {
-		cancelAll()
+		// the buttons stop working along with the reactions
+		if !cancelAll() {
+			expire()
+		}
 	})
+
+	return msg
 }
 
 func hasRole(s *discordgo.Session, guildID, userID, roleID string) bool {
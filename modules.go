@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/txtar"
+)
+
+// modulePackage is a well-known package outside of std which the auto-import can add.
+type modulePackage struct {
+	name    string // the package name used in the code
+	path    string // the import path
+	module  string
+	version string
+}
+
+var modulePackages = []modulePackage{
+	{"errgroup", "golang.org/x/sync/errgroup", "golang.org/x/sync", "v0.7.0"},
+	{"semaphore", "golang.org/x/sync/semaphore", "golang.org/x/sync", "v0.7.0"},
+	{"singleflight", "golang.org/x/sync/singleflight", "golang.org/x/sync", "v0.7.0"},
+	{"constraints", "golang.org/x/exp/constraints", "golang.org/x/exp", "v0.0.0-20240506185415-9bf2ced13842"},
+	{"rate", "golang.org/x/time/rate", "golang.org/x/time", "v0.5.0"},
+	{"uuid", "github.com/google/uuid", "github.com/google/uuid", "v1.6.0"},
+	{"decimal", "github.com/shopspring/decimal", "github.com/shopspring/decimal", "v1.4.0"},
+	{"yaml", "gopkg.in/yaml.v3", "gopkg.in/yaml.v3", "v3.0.1"},
+	{"assert", "github.com/stretchr/testify/assert", "github.com/stretchr/testify", "v1.9.0"},
+	{"require", "github.com/stretchr/testify/require", "github.com/stretchr/testify", "v1.9.0"},
+}
+
+// loadModulePackages replaces the well-known packages with the ones listed in the file, one per line:
+//
+//	<name> <import path> <module>@<version>
+//
+// Empty lines and lines starting with # are skipped.
+func loadModulePackages(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("loadModulePackages: %v", err)
+	}
+	defer f.Close()
+
+	var packages []modulePackage
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 || strings.Count(fields[2], "@") != 1 {
+			return fmt.Errorf("loadModulePackages: %s:%d: want <name> <import path> <module>@<version>", file, line)
+		}
+
+		at := strings.IndexByte(fields[2], '@')
+		packages = append(packages, modulePackage{
+			name:    fields[0],
+			path:    fields[1],
+			module:  fields[2][:at],
+			version: fields[2][at+1:],
+		})
+	}
+
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("loadModulePackages: %v", err)
+	}
+
+	modulePackages = packages
+
+	return nil
+}
+
+func findModulePackage(name string) (modulePackage, bool) {
+	for _, mp := range modulePackages {
+		if mp.name == name {
+			return mp, true
+		}
+	}
+
+	return modulePackage{}, false
+}
+
+// requiredModules collects the modules of the well-known packages imported by the main file and the rest of the archive.
+func requiredModules(f *ast.File, files []txtar.File) map[string]string {
+	paths := make(map[string]bool)
+
+	for _, s := range f.Imports {
+		paths[importPath(s)] = true
+	}
+
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name, ".go") {
+			continue
+		}
+
+		ff, err := parser.ParseFile(token.NewFileSet(), file.Name, file.Data, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+
+		for _, s := range ff.Imports {
+			paths[importPath(s)] = true
+		}
+	}
+
+	required := make(map[string]string)
+	for _, mp := range modulePackages {
+		if paths[mp.path] {
+			required[mp.module] = mp.version
+		}
+	}
+
+	return required
+}
+
+// generateGoMod returns the go.mod requiring the modules, goVersion is the go directive such as 1.22 and may be empty.
+func generateGoMod(required map[string]string, goVersion string) txtar.File {
+	var b strings.Builder
+
+	b.WriteString("module play.ground\n")
+
+	if goVersion != "" {
+		fmt.Fprintf(&b, "\ngo %s\n", goVersion)
+	}
+
+	modules := make([]string, 0, len(required))
+	for module := range required {
+		modules = append(modules, module)
+	}
+
+	sort.Strings(modules)
+
+	if len(modules) > 0 {
+		b.WriteString("\nrequire (\n")
+
+		for _, module := range modules {
+			fmt.Fprintf(&b, "\t%s %s\n", module, required[module])
+		}
+
+		b.WriteString(")\n")
+	}
+
+	return txtar.File{Name: "go.mod", Data: []byte(b.String())}
+}
+
+// goDirective turns a version such as go1.22.5 into the 1.22 of the go directive, empty for devel builds.
+func goDirective(version string) string {
+	if !strings.HasPrefix(version, "go1.") {
+		return ""
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(version, "go"), ".", 3)
+	minor := parts[1]
+
+	for i, r := range minor {
+		if r < '0' || r > '9' {
+			minor = minor[:i]
+
+			break
+		}
+	}
+
+	return parts[0] + "." + minor
+}
+
+func hasArchiveFile(files []txtar.File, name string) bool {
+	for _, f := range files {
+		if f.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
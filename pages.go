@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	maxPages       = 20
+	maxEmbedFields = 25
+	maxEmbedLength = 6000
+	// footerReserve keeps room in every page for the footer set after paginating.
+	footerReserve = 64
+)
+
+// pagedReply is a reply made of several embeds, the buttons under it switch between them.
+// The embedded MessageSend carries the first page along with the rest of the reply, like the link and the files.
+type pagedReply struct {
+	*discordgo.MessageSend
+	pages []*discordgo.MessageEmbed
+}
+
+func newPagedReply(pages []*discordgo.MessageEmbed) *pagedReply {
+	return &pagedReply{
+		MessageSend: &discordgo.MessageSend{
+			Embed:      pages[0],
+			Components: pageButtons(0, len(pages)),
+		},
+		pages: pages,
+	}
+}
+
+// paginate spreads the fields over as many embeds as they need, the description goes to the first one.
+// It reports whether the fields didn't fit into maxPages.
+func paginate(title, description string, fields []*discordgo.MessageEmbedField) ([]*discordgo.MessageEmbed, bool) {
+	var pages []*discordgo.MessageEmbed
+
+	page := &discordgo.MessageEmbed{
+		Title:       title,
+		Description: description,
+	}
+
+	length := len(title) + len(description) + footerReserve
+
+	for _, f := range fields {
+		size := len(f.Name) + len(f.Value)
+
+		if len(page.Fields) == maxEmbedFields || (len(page.Fields) > 0 && length+size > maxEmbedLength) {
+			pages = append(pages, page)
+			if len(pages) == maxPages {
+				return pages, true
+			}
+
+			page = &discordgo.MessageEmbed{
+				Title: title,
+			}
+
+			length = len(title) + footerReserve
+		}
+
+		page.Fields = append(page.Fields, f)
+		length += size
+	}
+
+	return append(pages, page), false
+}
+
+// setFooters puts the footer, such as the go version, and the page number under every page.
+func setFooters(pages []*discordgo.MessageEmbed, footer string) {
+	for i, page := range pages {
+		text := footer
+		if len(pages) > 1 {
+			if text != "" {
+				text += " · "
+			}
+
+			text += fmt.Sprintf("page %d/%d", i+1, len(pages))
+		}
+
+		if text != "" {
+			page.Footer = &discordgo.MessageEmbedFooter{
+				Text: text,
+			}
+		}
+	}
+}
+
+func pageButtons(page, total int) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "◀",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "pages:prev",
+					Disabled: page == 0,
+				},
+				discordgo.Button{
+					Label:    "▶",
+					Style:    discordgo.SecondaryButton,
+					CustomID: "pages:next",
+					Disabled: page == total-1,
+				},
+			},
+		},
+	}
+}
+
+// handlePages switches the pages of the sent message when its buttons are pressed.
+// It returns the handler remover and the func which takes the buttons away once the message stops responding.
+func handlePages(s *discordgo.Session, msg *discordgo.Message, pages []*discordgo.MessageEmbed) (func(), func()) {
+	var (
+		mtx     sync.Mutex
+		current int
+	)
+
+	remove := s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if i.Type != discordgo.InteractionMessageComponent || i.Message == nil || i.Message.ID != msg.ID {
+			return
+		}
+
+		mtx.Lock()
+		switch i.MessageComponentData().CustomID {
+		case "pages:prev":
+			if current > 0 {
+				current--
+			}
+		case "pages:next":
+			if current < len(pages)-1 {
+				current++
+			}
+		}
+
+		page := current
+		mtx.Unlock()
+
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Embeds:     []*discordgo.MessageEmbed{pages[page]},
+				Components: pageButtons(page, len(pages)),
+			},
+		})
+		if err != nil {
+			log.Println("handlePages:", err)
+		}
+	})
+
+	expire := func() {
+		mtx.Lock()
+		page := current
+		mtx.Unlock()
+
+		_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:         msg.ID,
+			Channel:    msg.ChannelID,
+			Embeds:     []*discordgo.MessageEmbed{pages[page]},
+			Components: []discordgo.MessageComponent{},
+		})
+		if err != nil {
+			log.Println("handlePages:", err)
+		}
+	}
+
+	return remove, expire
+}
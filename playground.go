@@ -9,9 +9,8 @@ import (
 	"go/parser"
 	"go/token"
 	"golang.org/x/tools/go/ast/astutil"
-	"io/ioutil"
+	"golang.org/x/tools/txtar"
 	"log"
-	"net/http"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,36 +19,18 @@ import (
 
 var bufferPool = &sync.Pool{}
 
-func PostToPlayground(src string) error {
-	req, err := http.NewRequest("POST", "https://play.golang.org/share", bytes.NewBufferString(src))
+func PostToPlayground(e Executor, src string) (string, error) {
+	link, err := e.Share(src)
 	if err != nil {
-		return fmt.Errorf("PostToPlayground: %v", err)
+		return "", fmt.Errorf("PostToPlayground: %v", err)
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
-	req.Header.Add("User-Agent", "Go_Playground")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("PostToPlayground: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("PostToPlayground: got non-200 response: %s", resp.Status)
-	}
-
-	linkID, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("PostToPlayground: %v", err)
-	}
-
-	return fmt.Errorf(`https://play.golang.org/p/%s`, b2s(linkID))
+	return link, nil
 }
 
 type Event struct {
 	Message string
-	Kind    string        // "stdout" or "stderr"
+	Kind    string        // "stdout", "stderr" or "note" the bot adds
 	Delay   time.Duration // time to wait before printing Message
 }
 
@@ -69,23 +50,102 @@ type playgroundResponse struct {
 	VetOK bool `json:",omitempty"`
 }
 
-func CompileAndRun(str string, debug bool) ([]byte, error) {
-	code := findCodeBlock(str)
-	if code == "" {
-		return nil, fmt.Errorf("Why, give me the code, human! Ye, right after the go command, go and write it down right there, okay? I don't mind if you use a code block. \n" +
+type runResult struct {
+	// response is the raw executor response, see playgroundResponse.
+	response []byte
+	// source is the prepared program, without the hidden helpers, as it was sent to the executor.
+	source string
+	// original is the program as the user wrote it, the positions in the response refer to it.
+	original string
+	// clock tells the time the program started at, empty if the clock of the executor was kept.
+	clock string
+	// removed holds the unused imports taken out of the code.
+	removed []string
+}
+
+type runOptions struct {
+	debug bool
+	// version is the go version asked for with -version, empty for the default one.
+	version string
+	// vet runs go vet along with the build.
+	vet bool
+	// test keeps the program without main, so it's run with go test even if no tests were found.
+	test bool
+	// bench is the pattern of the benchmarks to run instead of main, empty if it's not a benchmark run.
+	bench string
+	// eval prints every bare expression along with its value.
+	eval bool
+	// repl uses every variable declared by the bare statements, the session inputs don't have to.
+	repl bool
+	// clock is the value of -time, empty to keep the clock of the executor.
+	clock string
+}
+
+func CompileAndRun(e Executor, str string, opts runOptions) (*runResult, error) {
+	return compile(e, str, opts, true)
+}
+
+// PrepareSource rewrites the code the way CompileAndRun does without running it, the result holds the source only.
+// The imports are resolved locally, so nothing is sent to the executor but the version lookup.
+func PrepareSource(e Executor, str string, opts runOptions) (*runResult, error) {
+	return compile(e, str, opts, false)
+}
+
+func compile(e Executor, str string, opts runOptions, run bool) (*runResult, error) {
+	code, original := splitArchive(findSources(str))
+	version, err := e.Version(opts.version)
+	if err != nil {
+		log.Println(err)
+	}
+
+	// the imports are resolved with the std of the go version the code runs with
+	std := stdImportsFor(version)
+
+	files := prepareArchiveFiles(original, std)
+
+	// the code block starts on the line after the ```go one
+	code = strings.TrimPrefix(code, "\n")
+
+	if strings.TrimSpace(code) == "" {
+		return nil, fmt.Errorf("Why, give me the code, human! Ye, right after the go command, go and write it down right there, okay? I don't mind if you use a code block or a playground link. \n" +
+			"Several go code blocks, or -- name.go -- headers in one, make a module out of many files.\n" +
+			"Too long for a message? Attach .go, .txt or .txtar files instead.\n" +
 			"Here's a list of options available:\n" +
 			"-debug, or -d\n" +
 			"-plain or -p\n" +
+			"-share or -s\n" +
+			"-snippet=<id>, or a playground link\n" +
+			"-version=<go1.x|gotip|previous> or -v=...\n" +
+			"-vet\n" +
+			"-test or -t\n" +
+			"-bench[=regex] or -b\n" +
+			"-animate or -a\n" +
+			"-color or -c\n" +
+			"-eval, or the eval command\n" +
+			"-time=<RFC3339|real|random|playground>\n" +
 			"What do they do? Hmm, my boss can't word it correctly neither am I. So 'try it and see' is your way to go.\n" +
 			"Good luck!")
 	}
 
-	closeOnce := false
+	// testing.Benchmark sees no time pass with the fake clock, it would grow b.N until the program times out
+	if opts.bench != "" && run && !e.RealTime() {
+		return nil, fmt.Errorf("The benchmarks need a real clock, the playground fakes the time. They run with the local executor only.")
+	}
+
+	clk, err := parseClock(opts.clock)
+	if err != nil {
+		return nil, err
+	}
+
 	importMap := make(map[string]bool)
 	importIgnoreMap := make(map[string]bool)
 
 	var nextImports []func(fset *token.FileSet, f *ast.File)
 
+	// the imports the compiler found unused, removed ones the local pass missed
+	unusedImports := make(map[string]bool)
+	var removed []string
+
 	retries := 0
 
 	buf, ok := bufferPool.Get().(*bytes.Buffer)
@@ -97,7 +157,10 @@ func CompileAndRun(str string, debug bool) ([]byte, error) {
 
 	buf.WriteString(code)
 
-	var debugMemory string
+	var debugMemory, source string
+	var archive []txtar.File
+	var positions positionMaps
+	var clockUsed string
 	var lazyLines []string
 	retryCounter := 0
 	fset := token.NewFileSet()
@@ -105,7 +168,7 @@ retry:
 	retryCounter++
 	f, err := parser.ParseFile(fset, "", buf, 0)
 	if cannotFix := tryToFixErrors(err, &buf, &lazyLines, f, fset); cannotFix != nil {
-		if debug {
+		if opts.debug {
 			return nil, fmt.Errorf("%s\n------\n%v", b2s(buf.Bytes()), cannotFix)
 		}
 
@@ -118,7 +181,9 @@ retry:
 		goto retry
 	}
 
-	if !hasFunc(f, "main") {
+	if !hasFunc(f, "main") && (opts.test || hasTests(f) || opts.bench != "") && lazyLines == nil {
+		// go test or the benchmark runner supplies the main
+	} else if !hasFunc(f, "main") {
 		var lazyCode string
 
 		if lazyLines != nil {
@@ -137,70 +202,115 @@ retry:
 		goto retry
 	}
 
+	addMissingImports(fset, f, std)
+
 	for _, addImport := range nextImports {
 		addImport(fset, f)
 	}
 
-	if hasImport(f, "time") {
-		if !hasImport(f, "unsafe") {
-			astutil.AddNamedImport(fset, f, "_", "unsafe")
-		}
+	removed = removeUnusedImports(fset, f, std)
+
+	if opts.repl && lazyLines != nil {
+		renameRedeclared(f)
+		useDeclared(f)
 	}
 
-	buf.Reset()
+	var evalCode string
 
-	err = format.Node(buf, fset, f)
+	if opts.eval && lazyLines != nil {
+		evalExpressions(fset, f, buf.Bytes())
+		evalCode = evalTemplate
+	}
+
+	archive = files
+
+	if required := requiredModules(f, files); len(required) > 0 && !hasArchiveFile(files, "go.mod") {
+		archive = append(files[:len(files):len(files)], generateGoMod(required, goDirective(version)))
+	}
+
+	// the shared source is the code as it was before the benchmark runner took the place of main,
+	// its main is gone and the runner isn't part of f. It has the eval helper, the bare expressions call it.
+	var shared bytes.Buffer
+
+	err = format.Node(&shared, fset, f)
 	if err != nil {
 		return nil, fmt.Errorf("CompileAndRun: %v", err)
 	}
 
-	if hasImport(f, "time") {
-		buf.WriteString(randomTimeTemplate)
-	}
+	shared.WriteString(evalCode)
 
-	data := struct {
-		Body    string
-		WithVet bool
-	}{b2s(buf.Bytes()), false}
+	source = string(joinArchive(shared.Bytes(), archive))
 
-	if debug {
-		debugMemory = string(buf.Bytes()) + "\n------\n"
+	if !run {
+		return &runResult{source: source, original: string(joinArchive([]byte(code), original)), removed: removed}, nil
 	}
 
-	b, err := json.Marshal(&data)
-	if err != nil {
-		return nil, fmt.Errorf("CompileAndRun: %v", err)
+	var benchCode string
+
+	if opts.bench != "" {
+		names, err := benchmarks(f, opts.bench)
+		if err != nil {
+			return nil, err
+		}
+
+		renameFunc(f, "main", "_")
+		astutil.AddImport(fset, f, "fmt")
+		astutil.AddImport(fset, f, "testing")
+
+		benchCode = benchRunner(names)
 	}
 
-	if cap(b) > buf.Cap() {
-		buf = bytes.NewBuffer(b)
-	} else {
-		buf.Reset()
+	// the shared source keeps the clock of the playground
+	var clockCode string
 
-		buf.Write(b)
+	if clk != nil && overrideClock(f) {
+		astutil.AddImport(fset, f, "time")
+		clockCode = clk.code()
+		clockUsed = clk.String()
 	}
 
-	resp, err := http.Post("https://play.golang.org/compile", "application/json", buf)
+	buf.Reset()
+
+	err = format.Node(buf, fset, f)
 	if err != nil {
 		return nil, fmt.Errorf("CompileAndRun: %v", err)
 	}
 
-	if !closeOnce {
-		defer resp.Body.Close()
+	positions = newPositionMaps(code, b2s(buf.Bytes()), original, files)
+
+	buf.WriteString(benchCode)
+	buf.WriteString(evalCode)
+	buf.WriteString(clockCode)
+
+	if len(archive) > 0 {
+		buf = bytes.NewBuffer(joinArchive(buf.Bytes(), archive))
+	}
+
+	req := &compileRequest{
+		Body:    b2s(buf.Bytes()),
+		WithVet: opts.vet,
+		Version: opts.version,
+	}
 
-		closeOnce = true
+	if opts.debug {
+		debugMemory = string(buf.Bytes()) + "\n------\n"
 	}
 
-	b, err = ioutil.ReadAll(resp.Body)
+	b, err := e.Run(req)
 	if err != nil {
 		return nil, fmt.Errorf("CompileAndRun: %v", err)
 	}
 
+	if len(b) == 0 {
+		return nil, fmt.Errorf("CompileAndRun: empty response")
+	}
+
 	if b[0] != '{' {
-		nextImports = parseImportError(b, importMap, importIgnoreMap)
+		nextImports = parseImportError(b, importMap, importIgnoreMap, std)
+		nextImports = append(nextImports, unusedImportFixes(b, unusedImports)...)
 
 		if len(nextImports) == 0 || retries >= 1 {
-			if debug {
+			if opts.debug {
 				b = append([]byte(debugMemory), b...)
 			}
 
@@ -217,7 +327,8 @@ retry:
 	}
 
 	if !strings.HasPrefix(b2s(b), `{"Errors":""`) {
-		nextImports = parseImportError(b, importMap, importIgnoreMap)
+		nextImports = parseImportError(b, importMap, importIgnoreMap, std)
+		nextImports = append(nextImports, unusedImportFixes(b, unusedImports)...)
 
 		if len(nextImports) != 0 && retries < 1 {
 			buf.Reset()
@@ -229,14 +340,14 @@ retry:
 		}
 	}
 
-	if debug {
+	if opts.debug {
 		var res playgroundResponse
 
 		err = json.Unmarshal(b, &res)
 		if err != nil {
 			log.Println(err)
 
-			return b, nil
+			return &runResult{b, source, source, clockUsed, removedImports(removed, unusedImports)}, nil
 		}
 
 		res.Errors = debugMemory + res.Errors
@@ -245,14 +356,19 @@ retry:
 		if err != nil {
 			log.Println(err)
 
-			return b, nil
+			return &runResult{b, source, source, clockUsed, removedImports(removed, unusedImports)}, nil
 		}
 
 		b = bt
 	}
 
 ret:
-	return b, nil
+	if opts.debug {
+		// the positions refer to the code shown along with the errors
+		return &runResult{b, source, source, clockUsed, removedImports(removed, unusedImports)}, nil
+	}
+
+	return &runResult{positions.rewriteResponse(b), source, string(joinArchive([]byte(code), original)), clockUsed, removedImports(removed, unusedImports)}, nil
 }
 
 func tryToFixErrors(err error, buf **bytes.Buffer, lazyLines *[]string, f *ast.File, fset *token.FileSet) error {
@@ -311,7 +427,7 @@ func tryToFixErrors(err error, buf **bytes.Buffer, lazyLines *[]string, f *ast.F
 	return err
 }
 
-func parseImportError(str []byte, imports map[string]bool, ignore map[string]bool) (rimp []func(fset *token.FileSet, f *ast.File)) {
+func parseImportError(str []byte, imports map[string]bool, ignore map[string]bool, std []string) (rimp []func(fset *token.FileSet, f *ast.File)) {
 
 	var (
 		i, start, offset int
@@ -391,7 +507,7 @@ try_ignore_catch:
 	ignore[res] = true
 	once[res] = true
 
-	for _, imp := range stdImports {
+	for _, imp := range std {
 		if len(imp) < len(res) {
 			continue
 		}
@@ -413,6 +529,14 @@ try_ignore_catch:
 		}
 	}
 
+	if mp, ok := findModulePackage(res); ok {
+		rimp = append(rimp, func(fset *token.FileSet, f *ast.File) {
+			astutil.AddImport(fset, f, mp.path)
+		})
+
+		imports[res] = true
+	}
+
 	goto next
 }
 
@@ -486,6 +610,26 @@ func hasFunc(f *ast.File, name string) bool {
 	return false
 }
 
+// lazyBody returns the body of the function the bare statements are moved into, nil if there's none.
+func lazyBody(f *ast.File) *ast.BlockStmt {
+	for _, d := range f.Decls {
+		if fn, ok := d.(*ast.FuncDecl); ok && fn.Name.Name == "这他妈跟我们说好的不一样啊" {
+			return fn.Body
+		}
+	}
+
+	return nil
+}
+
+func renameFunc(f *ast.File, name, to string) {
+	for _, d := range f.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if ok && fn.Recv == nil && fn.Name.Name == name {
+			fn.Name.Name = to
+		}
+	}
+}
+
 func hasImport(f *ast.File, path string) bool {
 	is := importSpec(f, path)
 	if is != nil {
@@ -515,168 +659,10 @@ func importPath(s *ast.ImportSpec) string {
 }
 
 var undefined = []byte("undefined:")
-var prog = []byte("./prog.go")
+var prog = []byte("./prog")
 
 const packageStub = "package main\n"
 
-var stdImports = []string{
-	"archive",
-	"archive/tar",
-	"archive/zip",
-	"bufio",
-	"builtin",
-	"bytes",
-	"compress",
-	"compress/bzip2",
-	"compress/flate",
-	"compress/gzip",
-	"compress/lzw",
-	"compress/zlib",
-	"container",
-	"container/heap",
-	"container/list",
-	"container/ring",
-	"context",
-	"crypto",
-	"crypto/aes",
-	"crypto/cipher",
-	"crypto/des",
-	"crypto/dsa",
-	"crypto/ecdsa",
-	"crypto/ed25519",
-	"crypto/elliptic",
-	"crypto/hmac",
-	"crypto/md5",
-	"crypto/rc4",
-	"crypto/rsa",
-	"crypto/sha1",
-	"crypto/sha256",
-	"crypto/sha512",
-	"crypto/subtle",
-	"crypto/tls",
-	"crypto/x509",
-	"crypto/x509/pkix",
-	"database",
-	"database/sql",
-	"database/sql/driver",
-	"debug",
-	"debug/dwarf",
-	"debug/elf",
-	"debug/gosym",
-	"debug/macho",
-	"debug/pe",
-	"debug/plan9obj",
-	"encoding",
-	"encoding/ascii85",
-	"encoding/asn1",
-	"encoding/base32",
-	"encoding/base64",
-	"encoding/binary",
-	"encoding/csv",
-	"encoding/gob",
-	"encoding/hex",
-	"encoding/json",
-	"encoding/pem",
-	"encoding/xml",
-	"errors",
-	"expvar",
-	"flag",
-	"fmt",
-	"go",
-	"go/ast",
-	"go/build",
-	"go/constant",
-	"go/doc",
-	"go/format",
-	"go/importer",
-	"go/parser",
-	"go/printer",
-	"go/scanner",
-	"go/token",
-	"go/types",
-	"hash",
-	"hash/adler32",
-	"hash/crc32",
-	"hash/crc64",
-	"hash/fnv",
-	"hash/maphash",
-	"html",
-	"html/template",
-	"image",
-	"image/color",
-	"image/color/palette",
-	"image/draw",
-	"image/gif",
-	"image/jpeg",
-	"image/png",
-	"index",
-	"index/suffixarray",
-	"io",
-	"io/ioutil",
-	"log",
-	"log/syslog",
-	"math",
-	"math/big",
-	"math/bits",
-	"math/cmplx",
-	"math/rand",
-	"mime",
-	"mime/multipart",
-	"mime/quotedprintable",
-	"net",
-	"net/http",
-	"net/http/cgi",
-	"net/http/cookiejar",
-	"net/http/fcgi",
-	"net/http/httptest",
-	"net/http/httptrace",
-	"net/http/httputil",
-	"net/http/pprof",
-	"net/mail",
-	"net/rpc",
-	"net/rpc/jsonrpc",
-	"net/smtp",
-	"net/textproto",
-	"net/url",
-	"os",
-	"os/exec",
-	"os/signal",
-	"os/user",
-	"path",
-	"path/filepath",
-	"plugin",
-	"reflect",
-	"regexp",
-	"regexp/syntax",
-	"runtime",
-	"runtime/cgo",
-	"runtime/debug",
-	"runtime/msan",
-	"runtime/pprof",
-	"runtime/race",
-	"runtime/trace",
-	"sort",
-	"strconv",
-	"strings",
-	"sync",
-	"sync/atomic",
-	"syscall",
-	"syscall/js",
-	"testing",
-	"testing/iotest",
-	"testing/quick",
-	"text",
-	"text/scanner",
-	"text/tabwriter",
-	"text/template",
-	"text/template/parseCommand",
-	"time",
-	"unicode",
-	"unicode/utf16",
-	"unicode/utf8",
-	"unsafe",
-}
-
 var lazyTemplate = `
 type суперсекретнаяразработкакгб interface{}
 func 这他妈跟我们说好的不一样啊() interface{} {
@@ -690,16 +676,3 @@ func main() {
 	if result != суперсекретнаяразработкакгб(0) { fmt.Println(result) }
 }
 `
-
-var randomTimeTemplate = `
-//go:linkname ⴰⵣⵓⵍ runtime.fastrandn
-//go:nosplit
-func ⴰⵣⵓⵍ(n uint32) uint32
-
-var _ = time.Now()
-
-//go:linkname ⵖⵓⵔⴽ time.Now
-func ⵖⵓⵔⴽ() time.Time {
-	return time.Unix(int64(ⴰⵣⵓⵍ(2147483647)), 0)
-}
-`
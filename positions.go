@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/txtar"
+)
+
+// CompileAndRun rewrites the code before it's run: the package clause and the imports are added, the bare statements
+// are moved into a generated function, gofmt reformats the rest. The positions the compiler reports are mapped back
+// to the lines the user wrote by matching the rewritten lines against the original ones, the blanks aside.
+
+// positionMap maps the positions of a rewritten file to the original one.
+type positionMap struct {
+	original  []string
+	rewritten []string
+	// lines holds the 1-based original line of every rewritten one, 0 for the generated lines.
+	lines []int
+	// shifts holds how many non-blank chars of the original line precede the text of the rewritten one,
+	// it's not 0 when the rewritten line is a part of the original one, gofmt splits the lines joined with ;.
+	// It's negative when the original line is wrapped into the rewritten one, like the expressions of eval.
+	shifts []int
+}
+
+func newPositionMap(original, rewritten string) *positionMap {
+	p := &positionMap{
+		original:  strings.Split(original, "\n"),
+		rewritten: strings.Split(rewritten, "\n"),
+	}
+
+	p.lines = make([]int, len(p.rewritten))
+	p.shifts = make([]int, len(p.rewritten))
+
+	normalized := make([]string, len(p.original))
+	for i, line := range p.original {
+		normalized[i] = stripBlanks(line)
+	}
+
+	used := make([]bool, len(p.original))
+	last := -1
+
+	for j, line := range p.rewritten {
+		text := stripBlanks(clockNames.Replace(line))
+		if text == "" {
+			continue
+		}
+
+		// the moved lines are looked for from the top again
+		i := findLine(len(normalized), last+1, func(i int) bool {
+			return !used[i] && normalized[i] == text
+		})
+
+		if i != -1 {
+			used[i] = true
+		} else {
+			i = findLine(len(normalized), last, func(i int) bool {
+				return strings.Contains(normalized[i], text)
+			})
+
+			if i != -1 {
+				p.shifts[j] = strings.Index(normalized[i], text)
+			}
+		}
+
+		if i == -1 {
+			i = findLine(len(normalized), last+1, func(i int) bool {
+				return !used[i] && strings.IndexFunc(normalized[i], isWordChar) != -1 && strings.Contains(text, normalized[i])
+			})
+
+			if i == -1 {
+				continue
+			}
+
+			used[i] = true
+			p.shifts[j] = -strings.LastIndex(text, normalized[i])
+		}
+
+		p.lines[j] = i + 1
+		last = i
+	}
+
+	return p
+}
+
+// findLine returns the first of n lines matching, starting from the line from and wrapping around, -1 if none matches.
+func findLine(n, from int, match func(i int) bool) int {
+	if from < 0 {
+		from = 0
+	}
+
+	for k := 0; k < n; k++ {
+		if i := (from + k) % n; match(i) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// position maps the 1-based line and column, col is 0 if it's not known.
+// It reports false for the positions in the generated code.
+func (p *positionMap) position(line, col int) (int, int, bool) {
+	if line < 1 || line > len(p.lines) || p.lines[line-1] == 0 {
+		return 0, 0, false
+	}
+
+	orig := p.lines[line-1]
+	if col == 0 {
+		return orig, 0, true
+	}
+
+	rewritten := p.rewritten[line-1]
+	if col-1 > len(rewritten) {
+		col = len(rewritten) + 1
+	}
+
+	// the column goes to the same non-blank char of the original line
+	k := p.shifts[line-1] + len(stripBlanks(clockNames.Replace(rewritten[:col-1])))
+	if k < 0 {
+		k = 0
+	}
+
+	for i, r := range p.original[orig-1] {
+		if unicode.IsSpace(r) {
+			continue
+		}
+
+		if k == 0 {
+			return orig, i + 1, true
+		}
+
+		k--
+	}
+
+	return orig, len(p.original[orig-1]) + 1, true
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func stripBlanks(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+
+		return r
+	}, s)
+}
+
+// positionMaps holds the map of every file by its name, the main file is known both as prog.go and prog_test.go.
+type positionMaps map[string]*positionMap
+
+func newPositionMaps(code, rewritten string, original, prepared []txtar.File) positionMaps {
+	main := newPositionMap(code, rewritten)
+
+	maps := positionMaps{
+		"prog.go":      main,
+		"prog_test.go": main,
+	}
+
+	for i, f := range original {
+		if strings.HasSuffix(f.Name, ".go") && i < len(prepared) {
+			maps[path.Clean(f.Name)] = newPositionMap(string(f.Data), string(prepared[i].Data))
+		}
+	}
+
+	return maps
+}
+
+var positionRe = regexp.MustCompile(`((?:[\w.-]+/)*[\w.-]+\.go):(\d+)(?::(\d+))?`)
+
+// clockNames restores the calls the clock override swaps and the names renameRedeclared renames,
+// so the lines match the original ones.
+var clockNames = strings.NewReplacer(
+	"ⵖⵓⵔⴽ", "time.Now",
+	"ⵙⵉⵏⵙ", "time.Since",
+	"ⵓⵏⵜⵉⵍ", "time.Until",
+	replRenamed, "",
+)
+
+// generatedNames replaces the identifiers of the templates CompileAndRun adds, the user never wrote them.
+var generatedNames = strings.NewReplacer(
+	"这他妈跟我们说好的不一样啊", "main",
+	"суперсекретнаяразработкакгб", "interface{}",
+	"评估", "eval",
+	"ⵖⵓⵔⴽ", "time.Now",
+	"ⵙⵉⵏⵙ", "time.Since",
+	"ⵓⵏⵜⵉⵍ", "time.Until",
+	replRenamed, "",
+)
+
+// rewrite maps the positions mentioned in the text, the positions in the generated code lose their line and column.
+func (maps positionMaps) rewrite(text string) string {
+	text = positionRe.ReplaceAllStringFunc(text, func(pos string) string {
+		match := positionRe.FindStringSubmatch(pos)
+
+		name := match[1]
+
+		p, ok := maps[name]
+		for !ok && strings.Contains(name, "/") {
+			name = name[strings.IndexByte(name, '/')+1:]
+			p, ok = maps[name]
+		}
+
+		if !ok {
+			return pos
+		}
+
+		line, _ := strconv.Atoi(match[2])
+		col, _ := strconv.Atoi(match[3])
+
+		line, col, ok = p.position(line, col)
+		if !ok {
+			return match[1]
+		}
+
+		mapped := match[1] + ":" + strconv.Itoa(line)
+		if col > 0 {
+			mapped += ":" + strconv.Itoa(col)
+		}
+
+		return mapped
+	})
+
+	return generatedNames.Replace(text)
+}
+
+// rewriteResponse maps the positions of the compile errors, the vet report and stderr of the executor response,
+// along with stdout for the tests.
+func (maps positionMaps) rewriteResponse(b []byte) []byte {
+	if len(b) == 0 || b[0] != '{' {
+		return []byte(maps.rewrite(string(b)))
+	}
+
+	var res playgroundResponse
+
+	err := json.Unmarshal(b, &res)
+	if err != nil {
+		log.Println(err)
+
+		return b
+	}
+
+	res.Errors = maps.rewrite(res.Errors)
+	res.VetErrors = maps.rewrite(res.VetErrors)
+
+	// go test -v prints the logs of the tests to stdout
+	for i, e := range res.Events {
+		if e.Kind == "stderr" || res.IsTest {
+			res.Events[i].Message = maps.rewrite(e.Message)
+		}
+	}
+
+	bt, err := json.Marshal(res)
+	if err != nil {
+		log.Println(err)
+
+		return b
+	}
+
+	return bt
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A repl session keeps the code its author sent to a channel, every input reruns all of it.
+// The output of the previous inputs is hidden behind the marker printed right before the newest one.
+
+const (
+	replTTL       = 30 * time.Minute
+	replMaxInputs = 50
+	replMarker    = "\u2063repl\n"
+	// replMarkerStmt prints replMarker, the source keeps it escaped.
+	// It's an assignment rather than a bare call, so eval doesn't print it.
+	replMarkerStmt = `_, _ = fmt.Print("\u2063repl\n")`
+)
+
+type replInput struct {
+	id   string // the message the input came with, an edited message replaces its input
+	code string
+}
+
+type replSession struct {
+	inputs []replInput
+	used   time.Time
+}
+
+type replSessions struct {
+	mtx      sync.Mutex
+	sessions map[string]*replSession
+	ttl      time.Duration
+}
+
+var repls = &replSessions{
+	sessions: make(map[string]*replSession),
+	ttl:      replTTL,
+}
+
+// get returns the session of the author in the channel, the idle sessions are dropped along the way.
+func (r *replSessions) get(key string) *replSession {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for k, s := range r.sessions {
+		if time.Since(s.used) > r.ttl {
+			delete(r.sessions, k)
+		}
+	}
+
+	s, ok := r.sessions[key]
+	if !ok {
+		s = &replSession{}
+		r.sessions[key] = s
+	}
+
+	s.used = time.Now()
+
+	return s
+}
+
+func (r *replSessions) reset(key string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	delete(r.sessions, key)
+}
+
+// code returns the program of the session with the input run last, the input replaces the one of the same message.
+func (r *replSessions) code(s *replSession, in replInput) string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var b strings.Builder
+	for _, prev := range s.inputs {
+		if prev.id != in.id {
+			b.WriteString(prev.code + "\n")
+		}
+	}
+
+	b.WriteString(replMarkerStmt + "\n")
+	b.WriteString(in.code)
+
+	return b.String()
+}
+
+func (r *replSessions) add(s *replSession, in replInput) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for i, prev := range s.inputs {
+		if prev.id == in.id {
+			s.inputs = append(s.inputs[:i:i], s.inputs[i+1:]...)
+
+			break
+		}
+	}
+
+	s.inputs = append(s.inputs, in)
+}
+
+func (r *replSessions) show(s *replSession) string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	var b strings.Builder
+	for _, in := range s.inputs {
+		b.WriteString(in.code + "\n")
+	}
+
+	return b.String()
+}
+
+// repl is the command running the code in the session of the author, the session is dropped with reset and shown with show.
+func repl(cfg *config, s *discordgo.Session, m *discordgo.Message, res *parsingResult) {
+	key := m.ChannelID + "/" + m.Author.ID
+
+	switch strings.TrimSpace(res.content) {
+	case "reset":
+		repls.reset(key)
+		sendDeletable(s, m, "```\nThe session is gone, start over whenever you like.\n```", 5*time.Minute)
+
+		return
+	case "show":
+		code := repls.show(repls.get(key))
+		if code == "" {
+			sendDeletable(s, m, "```\nThe session is empty.\n```", 5*time.Minute)
+
+			return
+		}
+
+		var reply interface{} = fmt.Sprintf("```go\n%s```", code)
+		if len(code) > 2000-len("```go\n```") {
+			reply = withFiles("The session is too long, it's attached.", []*discordgo.File{{
+				Name:        "session.go",
+				ContentType: "text/plain",
+				Reader:      strings.NewReader(code),
+			}})
+		}
+
+		sendDeletable(s, m, reply, 5*time.Minute)
+
+		return
+	}
+
+	code := strings.TrimSpace(findCodeBlock(res.content))
+	if code == "" {
+		sendDeletable(s, m, "```\nGive me a statement or a declaration to add to the session, reset to start over or show to see it.\n```", 5*time.Minute)
+
+		return
+	}
+
+	session := repls.get(key)
+	if len(session.inputs) >= replMaxInputs {
+		sendDeletable(s, m, fmt.Sprintf("```\nThe session is full, %d inputs at most. Reset it to start over.\n```", replMaxInputs), 5*time.Minute)
+
+		return
+	}
+
+	in := replInput{id: m.ID, code: code}
+
+	result, err := CompileAndRun(cfg.executor, "```go\n"+repls.code(session, in)+"\n```", runOptions{eval: true, repl: true})
+	if err != nil {
+		sendDeletable(s, m, fmt.Sprintf("```\n%v```", err), 5*time.Minute)
+
+		return
+	}
+
+	var response playgroundResponse
+
+	err = json.Unmarshal(result.response, &response)
+	if err != nil {
+		log.Println(err)
+
+		return
+	}
+
+	// the inputs which don't build or crash are left out of the session
+	if response.Errors == "" && response.Status == 0 {
+		repls.add(session, in)
+	}
+
+	response.Events = replOutput(response.Events)
+
+	sendDeletable(s, m, renderRepl(&response), 5*time.Minute)
+}
+
+// replOutput drops the output of the previous inputs, everything is kept if the marker wasn't reached.
+func replOutput(events []Event) []Event {
+	for i, e := range events {
+		k := strings.Index(e.Message, replMarker)
+		if e.Kind != "stdout" || k == -1 {
+			continue
+		}
+
+		output := events[i+1:]
+		if rest := e.Message[k+len(replMarker):]; rest != "" {
+			output = append([]Event{{Message: rest, Kind: e.Kind}}, output...)
+		}
+
+		return output
+	}
+
+	return events
+}
+
+func renderRepl(response *playgroundResponse) interface{} {
+	if response.Errors != "" {
+		errs := response.Errors
+		cut := len(errs) > 2000-len("```go\n```")
+		if cut {
+			errs = errs[:2000-len("```go\n```")]
+		}
+
+		return withFiles(fmt.Sprintf("```go\n%s```", errs), outputFiles(response, false, cut))
+	}
+
+	var b strings.Builder
+	for _, e := range coalesceEvents(response.Events, 0) {
+		if isPrintable(e.Message) {
+			b.WriteString(e.Message)
+		}
+	}
+
+	output := strings.TrimSuffix(b.String(), "\n")
+	if output == "" {
+		output = "ok"
+	}
+
+	cut := len(output) > 2000-len("```\n\n```")
+	if cut {
+		output = output[:2000-len("```\n\n```")]
+	}
+
+	return withFiles(fmt.Sprintf("```\n%s\n```", output), outputFiles(response, cut, false))
+}
+
+// useDeclared uses every variable declared by the statements of the lazy function,
+// so the ones the newest input doesn't use don't fail the build.
+func useDeclared(f *ast.File) {
+	body := lazyBody(f)
+	if body == nil || len(body.List) == 0 {
+		return
+	}
+
+	var (
+		uses []ast.Stmt
+		seen = make(map[string]bool)
+	)
+
+	for _, stmt := range body.List {
+		for _, id := range declaredIdents(stmt) {
+			if seen[id.Name] {
+				continue
+			}
+
+			seen[id.Name] = true
+			uses = append(uses, &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent("_")},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{ast.NewIdent(id.Name)},
+			})
+		}
+	}
+
+	// the uses go before the return of the template
+	last := len(body.List) - 1
+	body.List = append(body.List[:last:last], append(uses, body.List[last])...)
+}
+
+// declaredIdents returns the names the := or var statement declares, the blank ones aside.
+func declaredIdents(stmt ast.Stmt) []*ast.Ident {
+	var names []*ast.Ident
+
+	switch st := stmt.(type) {
+	case *ast.AssignStmt:
+		if st.Tok != token.DEFINE {
+			return nil
+		}
+
+		for _, lhs := range st.Lhs {
+			if id, ok := lhs.(*ast.Ident); ok && id.Name != "_" {
+				names = append(names, id)
+			}
+		}
+	case *ast.DeclStmt:
+		gd, ok := st.Decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR {
+			return nil
+		}
+
+		for _, spec := range gd.Specs {
+			for _, id := range spec.(*ast.ValueSpec).Names {
+				if id.Name != "_" {
+					names = append(names, id)
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// replRenamed is appended to the earlier declarations of a name declared again, the positions and the errors drop it.
+const replRenamed = "ⵯ"
+
+// renameRedeclared lets the inputs declare a name again like a repl does, x := 1 followed by x := "one" in a later input
+// is no error: the earlier declarations of the name and their uses are renamed, x and its value of the newest one are left.
+// The x, y := with a new y keeps assigning x as in go.
+func renameRedeclared(f *ast.File) {
+	body := lazyBody(f)
+	if body == nil {
+		return
+	}
+
+	type declared struct {
+		obj     *ast.Object // the parser resolves every use, even the ones after a redeclaration, to the first one
+		renames int
+	}
+
+	var (
+		names = make(map[string]*declared)
+		again = make([]map[*ast.Ident]bool, len(body.List))
+	)
+
+	for i, stmt := range body.List {
+		ids := declaredIdents(stmt)
+
+		redeclared := make(map[*ast.Ident]bool)
+		for _, id := range ids {
+			if _, ok := names[id.Name]; ok {
+				redeclared[id] = true
+			}
+		}
+
+		if _, ok := stmt.(*ast.AssignStmt); ok && len(redeclared) < len(ids) {
+			redeclared = nil
+		}
+
+		for id := range redeclared {
+			names[id.Name].renames++
+		}
+
+		for _, id := range ids {
+			if _, ok := names[id.Name]; !ok {
+				names[id.Name] = &declared{obj: id.Obj}
+			}
+		}
+
+		again[i] = redeclared
+	}
+
+	version := make(map[string]int)
+
+	suffix := func(name string) string {
+		return strings.Repeat(replRenamed, names[name].renames-version[name])
+	}
+
+	for i, stmt := range body.List {
+		// the values of the redeclaring statement still see the earlier declaration
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok || again[i][id] {
+				return true
+			}
+
+			if d, ok := names[id.Name]; ok && d.renames > 0 && id.Obj == d.obj {
+				id.Name += suffix(id.Name)
+			}
+
+			return true
+		})
+
+		for id := range again[i] {
+			version[id.Name]++
+			id.Name += suffix(id.Name)
+		}
+	}
+}
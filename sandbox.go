@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/txtar"
+)
+
+// localExecutor builds and runs sources with the host go toolchain.
+// The program is started under rlimits, chrooted into its working dir in its own namespaces, see sandbox_linux.go.
+// It's not run at all if it can't be isolated.
+type localExecutor struct {
+	goBin     string
+	cpuTime   time.Duration
+	memory    int64
+	fileSize  int64
+	processes int
+	wallTime  time.Duration
+	maxOutput int
+
+	// the go command builds the code on the host, it gets limits of its own
+	buildCPUTime time.Duration
+	buildMemory  int64
+
+	versions *versionCache
+}
+
+// jailCommand is the argument the bot is started with as the second stage of localExecutor.run.
+const jailCommand = "-jail"
+
+func newLocalExecutor() *localExecutor {
+	return &localExecutor{
+		goBin:     "go",
+		cpuTime:   5 * time.Second,
+		memory:    512 << 20,
+		fileSize:  64 << 20,
+		processes: 64,
+		wallTime:  10 * time.Second,
+		maxOutput: 1 << 20,
+
+		buildCPUTime: time.Minute,
+		buildMemory:  2 << 30,
+
+		versions: newVersionCache(time.Hour),
+	}
+}
+
+func (l *localExecutor) Run(req *compileRequest) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		return nil, fmt.Errorf("localExecutor.Run: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// multi-file snippets come as txtar archives, the text before the first file is prog.go
+	arch := txtar.Parse([]byte(req.Body))
+
+	// the playground runs the programs made of tests with go test, so does this
+	isTest := isTestProgram(string(arch.Comment))
+
+	// the jail has no zoneinfo, the program carries its own
+	name, build, args := "prog.go", []string{"build", "-tags=timetzdata", "-o", "prog", "."}, []string(nil)
+	if isTest {
+		name, build, args = "prog_test.go", []string{"test", "-c", "-tags=timetzdata", "-o", "prog", "."}, []string{"-test.v"}
+	}
+
+	toolchain, err := l.toolchain(req.Version)
+	if err != nil {
+		return nil, fmt.Errorf("localExecutor.Run: %v", err)
+	}
+
+	// without the go directive the module would be built as go1.16 code
+	version, err := l.Version(req.Version)
+	if err != nil {
+		log.Println(err)
+	}
+
+	// the go.mod files of the snippet are read by the go command on the host
+	for i, file := range arch.Files {
+		if path.Base(file.Name) != "go.mod" {
+			continue
+		}
+
+		arch.Files[i].Data, err = checkGoMod(file.Name, file.Data)
+		if err != nil {
+			return json.Marshal(&playgroundResponse{Errors: err.Error() + "\n", IsTest: isTest})
+		}
+	}
+
+	files := append([]txtar.File{
+		generateGoMod(nil, goDirective(version)),
+		{Name: name, Data: arch.Comment},
+	}, arch.Files...)
+
+	for _, file := range files {
+		fpath := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+file.Name)))
+
+		err = os.MkdirAll(filepath.Dir(fpath), 0755)
+		if err != nil {
+			return nil, fmt.Errorf("localExecutor.Run: %v", err)
+		}
+
+		err = ioutil.WriteFile(fpath, file.Data, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("localExecutor.Run: %v", err)
+		}
+	}
+
+	response := playgroundResponse{
+		IsTest: isTest,
+	}
+
+	out, err := l.goCommand(dir, toolchain, build...)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("localExecutor.Run: %v", err)
+		}
+
+		response.Errors = trimBuildOutput(out)
+
+		return json.Marshal(&response)
+	}
+
+	if req.WithVet {
+		out, err = l.goCommand(dir, toolchain, "vet", ".")
+		response.VetErrors = trimBuildOutput(out)
+		response.VetOK = err == nil
+	}
+
+	response.Events, response.Status, err = l.run(dir, args...)
+	if err != nil {
+		response.Errors = err.Error()
+	}
+
+	if isTest {
+		response.TestsFailed = parseTestOutput(response.Events).failed
+	}
+
+	return json.Marshal(&response)
+}
+
+func (l *localExecutor) Share(src string) (string, error) {
+	return "", fmt.Errorf("localExecutor.Share: sharing isn't supported by the local executor")
+}
+
+func (l *localExecutor) Fetch(id string) (string, error) {
+	return "", fmt.Errorf("localExecutor.Fetch: snippets aren't supported by the local executor")
+}
+
+func (l *localExecutor) RealTime() bool {
+	return true
+}
+
+func (l *localExecutor) Version(version string) (string, error) {
+	toolchain, err := l.toolchain(version)
+	if err != nil {
+		return "", fmt.Errorf("localExecutor.Version: %v", err)
+	}
+
+	return l.versions.get(toolchain, func() (string, error) {
+		out, err := l.goCommand("", toolchain, "env", "GOVERSION")
+		if err != nil {
+			return "", fmt.Errorf("localExecutor.Version: %v: %s", err, out)
+		}
+
+		// the go command tells about the toolchain it downloads before the version
+		lines := strings.Split(strings.TrimSpace(b2s(out)), "\n")
+
+		return strings.TrimSpace(lines[len(lines)-1]), nil
+	})
+}
+
+// toolchain turns the go version asked for into a GOTOOLCHAIN value, the go command downloads the release if needed.
+// Since go1.21 the language version such as go1.22 isn't a release, the first release of it, go1.22.0, is taken then.
+func (l *localExecutor) toolchain(version string) (string, error) {
+	switch {
+	case version == "" || version == "stable" || version == "latest":
+		return "", nil
+	case strings.HasPrefix(version, "go1.") || strings.HasPrefix(version, "1."):
+		version = "go" + strings.TrimPrefix(version, "go")
+
+		minor, err := strconv.Atoi(strings.TrimPrefix(version, "go1."))
+		if err == nil && minor >= 21 {
+			version += ".0"
+		}
+
+		return version, nil
+	}
+
+	return "", fmt.Errorf("%s isn't available locally, only go1.x releases are", version)
+}
+
+// goEnv are the variables of the bot environment the go command gets, the rest such as DISCORD_TOKEN stays with the bot.
+var goEnv = []string{"PATH", "HOME", "TMPDIR", "XDG_CACHE_HOME", "GOCACHE", "GOPATH", "GOMODCACHE", "GOPROXY", "GOSUMDB", "GONOSUMDB", "GOPRIVATE", "GONOPROXY"}
+
+// goCommand runs the go command under the build limits, it sticks to the local toolchain unless another one is asked for.
+func (l *localExecutor) goCommand(dir, toolchain string, args ...string) ([]byte, error) {
+	limits := fmt.Sprintf("ulimit -t %d; ulimit -d %d; exec \"$0\" \"$@\"", int(l.buildCPUTime.Seconds()), l.buildMemory>>10)
+
+	cmd := exec.Command("sh", append([]string{"-c", limits, l.goBin}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = []string{"GOFLAGS=-mod=mod", "CGO_ENABLED=0", "GOWORK=off", "GOENV=off"}
+
+	for _, name := range goEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+
+	if toolchain == "" {
+		toolchain = "local"
+	}
+
+	cmd.Env = append(cmd.Env, "GOTOOLCHAIN="+toolchain)
+
+	timer := time.AfterFunc(time.Minute, func() {
+		cmd.Process.Kill()
+	})
+	defer timer.Stop()
+
+	return cmd.CombinedOutput()
+}
+
+// run starts the built program and records its output as playground events.
+// The bot is started again in a user namespace of its own as the second stage, runJailed,
+// which sets the limits there and starts the program in the jail.
+func (l *localExecutor) run(dir string, args ...string) ([]Event, int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, 0, fmt.Errorf("localExecutor.run: %v", err)
+	}
+
+	attr, err := sandboxAttr()
+	if err != nil {
+		return nil, 0, fmt.Errorf("localExecutor.run: unable to isolate the program: %v", err)
+	}
+
+	err = os.Mkdir(filepath.Join(dir, "tmp"), 0755)
+	if err != nil {
+		return nil, 0, fmt.Errorf("localExecutor.run: %v", err)
+	}
+
+	// the limits go in the order of jailLimits
+	stage := []string{
+		jailCommand,
+		strconv.Itoa(int(l.cpuTime.Seconds())),
+		strconv.FormatInt(l.memory, 10),
+		strconv.FormatInt(l.fileSize, 10),
+		strconv.Itoa(l.processes),
+	}
+
+	w := &eventWriter{limit: l.maxOutput, last: time.Now()}
+
+	cmd := exec.Command(self, append(stage, args...)...)
+	cmd.Dir = dir
+	cmd.Env = []string{"HOME=/", "TMPDIR=/tmp", "GOMAXPROCS=2"}
+	cmd.Stdout = w.kind("stdout")
+	cmd.Stderr = w.kind("stderr")
+	cmd.SysProcAttr = attr
+
+	// no fallback without the namespaces, the program would see the host and the network
+	err = cmd.Start()
+	if err != nil {
+		return nil, 0, fmt.Errorf("localExecutor.run: unable to isolate the program: %v", err)
+	}
+
+	timer := time.AfterFunc(l.wallTime, func() {
+		killGroup(cmd)
+	})
+
+	err = cmd.Wait()
+	if !timer.Stop() {
+		w.kind("stderr").Write([]byte("\ntimeout running program\n"))
+
+		return w.events, 1, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode() == -1 {
+			w.kind("stderr").Write([]byte("\n" + exitErr.Error() + "\n"))
+		}
+
+		return w.events, exitErr.ExitCode(), nil
+	}
+
+	if err != nil {
+		return w.events, 0, fmt.Errorf("localExecutor.run: %v", err)
+	}
+
+	return w.events, 0, nil
+}
+
+// checkGoMod drops the toolchain line of a go.mod of the snippet and refuses the replacements by the directories out of
+// the snippet, the go command on the host would switch the toolchain or read the host files otherwise.
+func checkGoMod(name string, data []byte) ([]byte, error) {
+	var b bytes.Buffer
+
+	for _, line := range strings.SplitAfter(b2s(data), "\n") {
+		code := line
+		if i := strings.Index(code, "//"); i != -1 {
+			code = code[:i]
+		}
+
+		fields := strings.Fields(code)
+		if len(fields) > 0 && fields[0] == "toolchain" {
+			continue
+		}
+
+		for i, field := range fields {
+			if field != "=>" || i+1 == len(fields) {
+				continue
+			}
+
+			target := strings.Trim(fields[i+1], "\"`")
+			if !strings.HasPrefix(target, "/") && !strings.HasPrefix(target, ".") && !filepath.IsAbs(target) {
+				// a module path
+				continue
+			}
+
+			// the directory is relative to the one of the go.mod
+			rel := path.Join(path.Dir(path.Clean(name)), target)
+			if path.IsAbs(target) || filepath.IsAbs(target) || rel == ".." || strings.HasPrefix(rel, "../") {
+				return nil, fmt.Errorf("%s: %s is out of the snippet, only the directories of the snippet can replace modules", name, target)
+			}
+		}
+
+		b.WriteString(line)
+	}
+
+	return b.Bytes(), nil
+}
+
+// trimBuildOutput drops the package headers the go command prints before its diagnostics.
+func trimBuildOutput(out []byte) string {
+	lines := strings.SplitAfter(b2s(out), "\n")
+
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if strings.HasPrefix(line, "# ") {
+			continue
+		}
+
+		buf.WriteString(line)
+	}
+
+	return buf.String()
+}
+
+// eventWriter collects the output of both streams in the order it was written.
+type eventWriter struct {
+	mtx    sync.Mutex
+	events []Event
+	size   int
+	limit  int
+	last   time.Time // when the previous event was written, for the delays
+}
+
+type eventKindWriter struct {
+	w    *eventWriter
+	kind string
+}
+
+func (w *eventWriter) kind(kind string) *eventKindWriter {
+	return &eventKindWriter{w: w, kind: kind}
+}
+
+func (k *eventKindWriter) Write(p []byte) (int, error) {
+	k.w.mtx.Lock()
+	defer k.w.mtx.Unlock()
+
+	n := len(p)
+	if k.w.size+n > k.w.limit {
+		p = p[:k.w.limit-k.w.size]
+	}
+
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	now := time.Now()
+
+	k.w.size += len(p)
+	k.w.events = append(k.w.events, Event{
+		Message: string(p),
+		Kind:    k.kind,
+		Delay:   now.Sub(k.w.last),
+	})
+
+	k.w.last = now
+
+	return n, nil
+}
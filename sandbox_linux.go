@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+// sandboxID is the uid and gid the program runs with inside its namespaces, it's not root there either,
+// so the program keeps no capability once it's started.
+const sandboxID = 65534
+
+// rlimitNproc is RLIMIT_NPROC, the syscall package lacks it.
+const rlimitNproc = 6
+
+// jailLimits are the resources the limits given to the second stage are for, in order: the cpu seconds,
+// the data segment and file sizes in bytes and the number of processes.
+var jailLimits = []int{syscall.RLIMIT_CPU, syscall.RLIMIT_DATA, syscall.RLIMIT_FSIZE, rlimitNproc}
+
+// sandboxAttr starts the second stage in its own user namespace, so the process limit counts the processes in there only.
+func sandboxAttr() (*syscall.SysProcAttr, error) {
+	return &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: sandboxID, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: sandboxID, HostID: os.Getgid(), Size: 1},
+		},
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}, nil
+}
+
+// jailAttr puts the program into fresh user, mount, network, pid, ipc and uts namespaces and chroots it into dir.
+// There's no /proc in there, the program sees nothing but its working dir and has no network access.
+func jailAttr(dir string) *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: sandboxID, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: sandboxID, HostID: os.Getgid(), Size: 1},
+		},
+		Chroot:    dir,
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
+
+// runJailed is the second stage of localExecutor.run, the args are the limits followed by the args of the program.
+// It runs the program of the working dir in the jail and exits the way the program did.
+func runJailed(args []string) {
+	if len(args) < len(jailLimits) {
+		jailFailed("the limits are missing")
+	}
+
+	for i, resource := range jailLimits {
+		limit, err := strconv.ParseUint(args[i], 10, 64)
+		if err != nil {
+			jailFailed(err.Error())
+		}
+
+		err = syscall.Setrlimit(resource, &syscall.Rlimit{Cur: limit, Max: limit})
+		if err != nil {
+			jailFailed(err.Error())
+		}
+	}
+
+	args = args[len(jailLimits):]
+
+	dir, err := os.Getwd()
+	if err != nil {
+		jailFailed(err.Error())
+	}
+
+	// Pdeathsig is sent when the thread which started the program exits
+	runtime.LockOSThread()
+
+	cmd := exec.Command("/prog", args...)
+	cmd.Dir = "/"
+	cmd.Env = os.Environ()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = jailAttr(dir)
+
+	err = cmd.Run()
+	if err == nil {
+		os.Exit(0)
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		jailFailed(err.Error())
+	}
+
+	// the signal the program died of goes on to the first stage
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		signal.Reset(status.Signal())
+		syscall.Kill(os.Getpid(), status.Signal())
+	}
+
+	os.Exit(exitErr.ExitCode())
+}
+
+func jailFailed(reason string) {
+	os.Stderr.WriteString("unable to isolate the program: " + reason + "\n")
+	os.Exit(1)
+}
+
+func killGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+
+		return
+	}
+
+	cmd.Process.Kill()
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func sandboxAttr() (*syscall.SysProcAttr, error) {
+	return nil, errors.New("the programs can be isolated on linux only")
+}
+
+func runJailed(args []string) {
+	os.Stderr.WriteString("the programs can be isolated on linux only\n")
+	os.Exit(1)
+}
+
+func killGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:generate sh -c "{ go env GOVERSION | sed 's/^/# /'; go list std | grep -v -E '(^|/)internal(/|$)|^vendor/'; } > std.txt"
+
+// std.txt lists the std packages of the toolchain it was generated with, the first line tells which one.
+//
+//go:embed std.txt
+var embeddedStd string
+
+// stdImports is the list of std packages used when the go version has none of its own:
+// the embedded one, replaced by the list of the local toolchain if there's one.
+var stdImports, _ = parseStdList(embeddedStd)
+
+var stdLists = struct {
+	sync.Mutex
+	lists   map[string][]string // by the go directive version such as 1.22
+	pending map[string]bool
+	goBin   string // empty if there's no toolchain to list the versions with
+}{
+	lists:   make(map[string][]string),
+	pending: make(map[string]bool),
+}
+
+// parseStdList returns the packages of the list and the go version it was made with.
+func parseStdList(text string) ([]string, string) {
+	var (
+		packages []string
+		version  string
+	)
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			version = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+		default:
+			packages = append(packages, line)
+		}
+	}
+
+	return packages, version
+}
+
+// loadStdImports lists std with the local toolchain, its list replaces the embedded one.
+// The go versions asked for later get their own lists with that toolchain too.
+func loadStdImports() error {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return fmt.Errorf("loadStdImports: %v", err)
+	}
+
+	packages, version, err := listStd(goBin, "local")
+	if err != nil {
+		return err
+	}
+
+	stdLists.Lock()
+	defer stdLists.Unlock()
+
+	stdImports = packages
+	stdLists.goBin = goBin
+	stdLists.lists[goDirective(version)] = packages
+
+	return nil
+}
+
+func listStd(goBin, toolchain string) ([]string, string, error) {
+	cmd := exec.Command("sh", "-c", `"$0" env GOVERSION | sed 's/^/# /'; "$0" list std`, goBin)
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN="+toolchain, "GOFLAGS=")
+
+	timer := time.AfterFunc(time.Minute, func() {
+		cmd.Process.Kill()
+	})
+	defer timer.Stop()
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("listStd: %s: %v", toolchain, err)
+	}
+
+	packages, version := parseStdList(string(out))
+
+	var public []string
+	for _, p := range packages {
+		if !strings.HasPrefix(p, "vendor/") && !isInternal(p) {
+			public = append(public, p)
+		}
+	}
+
+	return public, version, nil
+}
+
+func isInternal(p string) bool {
+	return p == "internal" || strings.HasPrefix(p, "internal/") || strings.HasSuffix(p, "/internal") || strings.Contains(p, "/internal/")
+}
+
+// stdImportsFor returns the std packages of the go version such as go1.22.5.
+// A version seen for the first time gets the fallback list while the toolchain lists it in the background.
+func stdImportsFor(version string) []string {
+	directive := goDirective(version)
+
+	stdLists.Lock()
+	defer stdLists.Unlock()
+
+	if packages, ok := stdLists.lists[directive]; ok {
+		return packages
+	}
+
+	if directive != "" && stdLists.goBin != "" && !stdLists.pending[directive] {
+		stdLists.pending[directive] = true
+
+		go func(goBin string) {
+			packages, _, err := listStd(goBin, version)
+			if err != nil {
+				// the fallback stays for that version
+				log.Println(err)
+
+				packages = stdImports
+			}
+
+			stdLists.Lock()
+			stdLists.lists[directive] = packages
+			stdLists.Unlock()
+		}(stdLists.goBin)
+	}
+
+	return stdImports
+}